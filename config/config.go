@@ -2,10 +2,15 @@ package config
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/viper"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // UpgradeOrder represents the order in which nodes should be upgraded
@@ -20,15 +25,83 @@ const (
 
 // Config represents the main configuration structure
 type Config struct {
-	Talos TalosConfig `mapstructure:"talos"`
-	K8s   K8sConfig   `mapstructure:"k8s"`
+	Talos         TalosConfig         `mapstructure:"talos"`
+	K8s           K8sConfig           `mapstructure:"k8s"`
+	Journal       JournalConfig       `mapstructure:"journal"`
+	Lock          LockConfig          `mapstructure:"lock"`
+	Drain         DrainConfig         `mapstructure:"drain"`
+	Nodes         NodesConfig         `mapstructure:"nodes"`
+	Waves         []WaveConfig        `mapstructure:"waves"`
+	Etcd          EtcdConfig          `mapstructure:"etcd"`
+	Waits         WaitsConfig         `mapstructure:"waits"`
+	Compatibility CompatibilityConfig `mapstructure:"compatibility"`
+	Maintenance   MaintenanceConfig   `mapstructure:"maintenance"`
+	Notifications NotificationsConfig `mapstructure:"notifications"`
 }
 
 // TalosConfig represents Talos-specific configuration
 type TalosConfig struct {
-	ImageID      string       `mapstructure:"imageId"`
-	Version      string       `mapstructure:"version"`
-	UpgradeOrder UpgradeOrder `mapstructure:"upgradeOrder"`
+	ImageID           string       `mapstructure:"imageId"`
+	Version           string       `mapstructure:"version"`
+	UpgradeOrder      UpgradeOrder `mapstructure:"upgradeOrder"`
+	MaxUnavailable    string       `mapstructure:"maxUnavailable"`
+	RollbackOnFailure bool         `mapstructure:"rollbackOnFailure"`
+	// ImageOverrides replace ImageID for the nodes they match, the first matching override wins
+	ImageOverrides []ImageOverride `mapstructure:"imageOverrides"`
+	// Schematic declares the installer image instead of ImageID
+	Schematic SchematicConfig `mapstructure:"schematic"`
+}
+
+// ImageOverride is the installer image for the nodes matched by its label selector, name patterns and
+// architecture, e.g. a schematic with the extensions of a board or the image of another CPU architecture.
+// Every criterion that is set must match.
+type ImageOverride struct {
+	NodeSelector `mapstructure:",squash"`
+	// Architecture is the CPU architecture the node reports to Kubernetes, e.g. amd64 or arm64
+	Architecture string `mapstructure:"architecture"`
+	ImageID      string `mapstructure:"imageId"`
+}
+
+// validateImageOverrides checks that every override has an image and matches nodes somehow
+func validateImageOverrides(overrides []ImageOverride) error {
+	for i, override := range overrides {
+		if override.ImageID == "" {
+			return fmt.Errorf("override %d has no imageId", i+1)
+		}
+		if override.IsEmpty() && override.Architecture == "" {
+			return fmt.Errorf("override %d needs labels, names or an architecture", i+1)
+		}
+		if err := override.validate(); err != nil {
+			return fmt.Errorf("override %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// WorkerConcurrency returns how many of the given number of worker nodes may be upgraded at once.
+// MaxUnavailable is either an absolute count ("3") or a percentage of the workers ("25%"),
+// rounded down but never below one. An empty value upgrades workers one at a time.
+func (t TalosConfig) WorkerConcurrency(workerCount int) (int, error) {
+	if t.MaxUnavailable == "" {
+		return 1, nil
+	}
+
+	var concurrency int
+	if percent, isPercent := strings.CutSuffix(t.MaxUnavailable, "%"); isPercent {
+		value, err := strconv.Atoi(percent)
+		if err != nil || value <= 0 || value > 100 {
+			return 0, fmt.Errorf("percentage must be between 1%% and 100%%, got '%s'", t.MaxUnavailable)
+		}
+		concurrency = workerCount * value / 100
+	} else {
+		value, err := strconv.Atoi(t.MaxUnavailable)
+		if err != nil || value <= 0 {
+			return 0, fmt.Errorf("must be a positive number or a percentage, got '%s'", t.MaxUnavailable)
+		}
+		concurrency = value
+	}
+
+	return max(concurrency, 1), nil
 }
 
 // K8sConfig represents Kubernetes-specific configuration
@@ -37,6 +110,126 @@ type K8sConfig struct {
 	UpgradeOrder UpgradeOrder `mapstructure:"upgradeOrder"`
 }
 
+// JournalConfig represents where upgrade progress is recorded for resuming interrupted runs
+type JournalConfig struct {
+	Path string `mapstructure:"path"`
+}
+
+// LockConfig represents the Lease that keeps two upgrades from running against the cluster at the same time
+type LockConfig struct {
+	Namespace string `mapstructure:"namespace"`
+	Name      string `mapstructure:"name"`
+	// Duration is how long the lease stays valid without being renewed, e.g. after water was killed
+	Duration time.Duration `mapstructure:"duration"`
+}
+
+// DrainConfig represents how nodes are cordoned and drained before a Talos upgrade reboots them
+type DrainConfig struct {
+	Enabled            bool          `mapstructure:"enabled"`
+	Timeout            time.Duration `mapstructure:"timeout"`
+	GracePeriod        time.Duration `mapstructure:"gracePeriod"`
+	IgnoreDaemonSets   bool          `mapstructure:"ignoreDaemonSets"`
+	DeleteEmptyDirData bool          `mapstructure:"deleteEmptyDirData"`
+	Force              bool          `mapstructure:"force"`
+}
+
+// CompatibilityConfig represents where to find Talos/Kubernetes compatibility data beyond the built-in matrix
+type CompatibilityConfig struct {
+	OverrideFile string `mapstructure:"overrideFile"`
+}
+
+// WaitsConfig represents how long the upgrade waits for nodes and the cluster to become healthy.
+// Each wait ends as soon as its condition holds, but never before its minimum soak time has passed.
+type WaitsConfig struct {
+	// RebootTimeout bounds how long a node may take to reboot and answer the Talos API again
+	RebootTimeout time.Duration `mapstructure:"rebootTimeout"`
+	// Node is the wait for a single node to be Ready, on the expected kubelet version and running its static pods
+	Node WaitConfig `mapstructure:"node"`
+	// Phase is the wait for all upgraded nodes to be healthy between waves and between the Talos and Kubernetes phases
+	Phase WaitConfig `mapstructure:"phase"`
+}
+
+// WaitConfig represents the bounds of a single condition-based wait
+type WaitConfig struct {
+	MinSoak time.Duration `mapstructure:"minSoak"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// EtcdConfig represents the etcd health gate around control plane node upgrades
+type EtcdConfig struct {
+	HealthCheck     bool          `mapstructure:"healthCheck"`
+	AllowQuorumLoss bool          `mapstructure:"allowQuorumLoss"`
+	HealthTimeout   time.Duration `mapstructure:"healthTimeout"`
+}
+
+// NodesConfig represents which nodes are candidates for upgrade
+type NodesConfig struct {
+	Include NodeSelector `mapstructure:"include"`
+	Exclude NodeSelector `mapstructure:"exclude"`
+}
+
+// NodeSelector matches nodes by Kubernetes label selector and/or glob patterns on node names
+type NodeSelector struct {
+	Labels string   `mapstructure:"labels"`
+	Names  []string `mapstructure:"names"`
+}
+
+// IsEmpty returns true if the selector has no criteria
+func (s NodeSelector) IsEmpty() bool {
+	return s.Labels == "" && len(s.Names) == 0
+}
+
+// validate checks that the label selector and name patterns are well-formed
+func (s NodeSelector) validate() error {
+	if s.Labels != "" {
+		if _, err := labels.Parse(s.Labels); err != nil {
+			return fmt.Errorf("invalid label selector '%s': %w", s.Labels, err)
+		}
+	}
+	for _, pattern := range s.Names {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid name pattern '%s': %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// WaveConfig represents a named group of nodes upgraded together, in the order waves are declared
+type WaveConfig struct {
+	Name        string        `mapstructure:"name"`
+	Selector    string        `mapstructure:"selector"`
+	Nodes       []string      `mapstructure:"nodes"`
+	Concurrency int           `mapstructure:"concurrency"`
+	Soak        time.Duration `mapstructure:"soak"`
+}
+
+// validateWaves checks that every wave is named uniquely and selects nodes somehow
+func validateWaves(waves []WaveConfig) error {
+	names := make(map[string]bool)
+	for i, wave := range waves {
+		if wave.Name == "" {
+			return fmt.Errorf("wave %d has no name", i+1)
+		}
+		if names[wave.Name] {
+			return fmt.Errorf("wave name '%s' is used more than once", wave.Name)
+		}
+		names[wave.Name] = true
+
+		if wave.Selector == "" && len(wave.Nodes) == 0 {
+			return fmt.Errorf("wave '%s' needs a selector or a list of nodes", wave.Name)
+		}
+		if wave.Selector != "" {
+			if _, err := labels.Parse(wave.Selector); err != nil {
+				return fmt.Errorf("wave '%s' has an invalid selector '%s': %w", wave.Name, wave.Selector, err)
+			}
+		}
+		if wave.Concurrency < 0 {
+			return fmt.Errorf("wave '%s' has a negative concurrency", wave.Name)
+		}
+	}
+	return nil
+}
+
 // LoadConfig loads configuration from a YAML file using Viper
 func LoadConfig(configPath string) (*Config, error) {
 	// Set up Viper
@@ -62,6 +255,8 @@ func LoadConfig(configPath string) (*Config, error) {
 		v.AddConfigPath(dir)
 	}
 
+	setDefaults(v)
+
 	// Read the config file
 	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
@@ -69,10 +264,34 @@ func LoadConfig(configPath string) (*Config, error) {
 
 	log.Info().Str("file", v.ConfigFileUsed()).Msg("Configuration file loaded successfully")
 
+	return load(v)
+}
+
+// FromMap builds a configuration from already decoded values, such as the spec of a custom resource,
+// applying the same defaults and validation as LoadConfig
+func FromMap(values map[string]interface{}) (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+
+	if err := v.MergeConfigMap(values); err != nil {
+		return nil, fmt.Errorf("failed to read configuration values: %w", err)
+	}
+
+	return load(v)
+}
+
+// setDefaults sets the defaults that cannot be told apart from an explicit zero value after unmarshalling
+func setDefaults(v *viper.Viper) {
+	// DaemonSet pods are recreated on the node anyway, so skipping them is the useful default
+	v.SetDefault("drain.ignoreDaemonSets", true)
+	v.SetDefault("etcd.healthCheck", true)
+}
+
+// load validates the values read into v and unmarshals them into a Config
+func load(v *viper.Viper) (*Config, error) {
 	// Validate mandatory fields using Viper
 	mandatoryFields := []string{
 		"talos.version",
-		"talos.imageId",
 		"k8s.version",
 	}
 
@@ -97,6 +316,14 @@ func LoadConfig(configPath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	// The installer image is either given as is or declared as a schematic
+	if config.Talos.ImageID == "" && config.Talos.Schematic.IsEmpty() {
+		return nil, fmt.Errorf("required field 'talos.imageId' is missing or empty, set it or declare talos.schematic")
+	}
+	if config.Talos.ImageID != "" && !config.Talos.Schematic.IsEmpty() {
+		return nil, fmt.Errorf("talos.imageId and talos.schematic are mutually exclusive")
+	}
+
 	// Set default upgrade orders if not specified
 	if config.Talos.UpgradeOrder == "" {
 		config.Talos.UpgradeOrder = ControlPlaneFirst
@@ -105,6 +332,62 @@ func LoadConfig(configPath string) (*Config, error) {
 		config.K8s.UpgradeOrder = ControlPlaneFirst
 	}
 
+	// Set default upgrade lock lease if not specified
+	if config.Lock.Namespace == "" {
+		config.Lock.Namespace = "kube-system"
+	}
+	if config.Lock.Name == "" {
+		config.Lock.Name = "water-upgrade"
+	}
+	// The lease cannot be renewed while a control plane node reboots, so the default outlasts a reboot
+	if config.Lock.Duration == 0 {
+		config.Lock.Duration = 10 * time.Minute
+	}
+
+	// Set default drain timeouts if not specified
+	if config.Drain.Timeout == 0 {
+		config.Drain.Timeout = 5 * time.Minute
+	}
+
+	// Set default etcd recovery timeout if not specified
+	if config.Etcd.HealthTimeout == 0 {
+		config.Etcd.HealthTimeout = 5 * time.Minute
+	}
+
+	// Set default wait timeouts if not specified, soak times default to none
+	if config.Waits.RebootTimeout == 0 {
+		config.Waits.RebootTimeout = 8 * time.Minute
+	}
+	if config.Waits.Node.Timeout == 0 {
+		config.Waits.Node.Timeout = 10 * time.Minute
+	}
+	if config.Waits.Phase.Timeout == 0 {
+		config.Waits.Phase.Timeout = 10 * time.Minute
+	}
+
+	// Set default Image Factory if not specified
+	if config.Talos.Schematic.FactoryURL == "" {
+		config.Talos.Schematic.FactoryURL = DefaultFactoryURL
+	}
+
+	// Set default per-node duration estimate for maintenance windows if not specified
+	if config.Maintenance.NodeDuration == 0 {
+		config.Maintenance.NodeDuration = 15 * time.Minute
+	}
+
+	// Set default notification delivery settings if not specified
+	if config.Notifications.Timeout == 0 {
+		config.Notifications.Timeout = 10 * time.Second
+	}
+	for i := range config.Notifications.Webhooks {
+		if config.Notifications.Webhooks[i].Format == "" {
+			config.Notifications.Webhooks[i].Format = "json"
+		}
+	}
+	if config.Notifications.Email.Enabled() && config.Notifications.Email.Port == 0 {
+		config.Notifications.Email.Port = 587
+	}
+
 	// Validate upgrade orders
 	if config.Talos.UpgradeOrder != ControlPlaneFirst && config.Talos.UpgradeOrder != WorkersFirst {
 		return nil, fmt.Errorf("invalid talos.upgradeOrder '%s': must be '%s' or '%s'",
@@ -115,12 +398,69 @@ func LoadConfig(configPath string) (*Config, error) {
 			config.K8s.UpgradeOrder, ControlPlaneFirst, WorkersFirst)
 	}
 
+	// The lease is renewed every third of its duration, so it must not be too short
+	if config.Lock.Duration < 15*time.Second {
+		return nil, fmt.Errorf("invalid lock.duration '%s': must be at least 15s", config.Lock.Duration)
+	}
+
+	// Validate node selectors
+	if err := config.Nodes.Include.validate(); err != nil {
+		return nil, fmt.Errorf("invalid nodes.include: %w", err)
+	}
+	if err := config.Nodes.Exclude.validate(); err != nil {
+		return nil, fmt.Errorf("invalid nodes.exclude: %w", err)
+	}
+
+	// Validate the declared schematic
+	if !config.Talos.Schematic.IsEmpty() {
+		if err := config.Talos.Schematic.validate(); err != nil {
+			return nil, fmt.Errorf("invalid talos.schematic: %w", err)
+		}
+	}
+
+	// Validate installer image overrides
+	if err := validateImageOverrides(config.Talos.ImageOverrides); err != nil {
+		return nil, fmt.Errorf("invalid talos.imageOverrides: %w", err)
+	}
+
+	// Validate upgrade waves
+	if err := validateWaves(config.Waves); err != nil {
+		return nil, fmt.Errorf("invalid waves: %w", err)
+	}
+
+	// Validate maintenance windows
+	if err := config.Maintenance.validate(); err != nil {
+		return nil, fmt.Errorf("invalid maintenance: %w", err)
+	}
+
+	// Validate notification backends
+	if err := config.Notifications.validate(); err != nil {
+		return nil, fmt.Errorf("invalid notifications: %w", err)
+	}
+
+	// Validate the worker concurrency budget
+	if _, err := config.Talos.WorkerConcurrency(1); err != nil {
+		return nil, fmt.Errorf("invalid talos.maxUnavailable: %w", err)
+	}
+
 	log.Info().
 		Str("talos_version", config.Talos.Version).
 		Str("talos_image_id", config.Talos.ImageID).
+		Int("talos_image_overrides", len(config.Talos.ImageOverrides)).
+		Strs("talos_schematic_extensions", config.Talos.Schematic.Extensions).
 		Str("talos_upgrade_order", string(config.Talos.UpgradeOrder)).
+		Str("talos_max_unavailable", config.Talos.MaxUnavailable).
+		Bool("talos_rollback_on_failure", config.Talos.RollbackOnFailure).
 		Str("k8s_version", config.K8s.Version).
 		Str("k8s_upgrade_order", string(config.K8s.UpgradeOrder)).
+		Bool("drain_enabled", config.Drain.Enabled).
+		Int("waves", len(config.Waves)).
+		Bool("etcd_health_check", config.Etcd.HealthCheck).
+		Dur("waits_node_min_soak", config.Waits.Node.MinSoak).
+		Dur("waits_phase_min_soak", config.Waits.Phase.MinSoak).
+		Int("maintenance_windows", len(config.Maintenance.Windows)).
+		Int("notification_webhooks", len(config.Notifications.Webhooks)).
+		Bool("notification_email", config.Notifications.Email.Enabled()).
 		Msg("Configuration loaded and validated")
 
 	return &config, nil
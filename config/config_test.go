@@ -0,0 +1,37 @@
+package config
+
+import "testing"
+
+func TestWorkerConcurrency(t *testing.T) {
+	tests := []struct {
+		maxUnavailable string
+		workers        int
+		want           int
+		wantErr        bool
+	}{
+		{"", 10, 1, false},
+		{"3", 10, 3, false},
+		{"3", 2, 3, false},
+		{"25%", 10, 2, false},
+		{"25%", 3, 1, false},
+		{"50%", 0, 1, false},
+		{"100%", 7, 7, false},
+		{"0", 10, 0, true},
+		{"-1", 10, 0, true},
+		{"0%", 10, 0, true},
+		{"101%", 10, 0, true},
+		{"a%", 10, 0, true},
+		{"three", 10, 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := TalosConfig{MaxUnavailable: tt.maxUnavailable}.WorkerConcurrency(tt.workers)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("WorkerConcurrency(%q, %d) error = %v, want error: %t", tt.maxUnavailable, tt.workers, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("WorkerConcurrency(%q, %d) = %d, want %d", tt.maxUnavailable, tt.workers, got, tt.want)
+		}
+	}
+}
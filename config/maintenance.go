@@ -0,0 +1,200 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceConfig restricts upgrades to recurring maintenance windows. Without windows, upgrades may run at any time.
+type MaintenanceConfig struct {
+	// Timezone is the IANA time zone windows and blackout dates are interpreted in (default: UTC)
+	Timezone string              `mapstructure:"timezone"`
+	Windows  []MaintenanceWindow `mapstructure:"windows"`
+	// Blackouts are dates, e.g. "2025-12-24", on which no upgrade may run even inside a window
+	Blackouts []string `mapstructure:"blackouts"`
+	// NodeDuration is the estimated time a single node takes to upgrade, used to stop before a window closes
+	NodeDuration time.Duration `mapstructure:"nodeDuration"`
+}
+
+// MaintenanceWindow represents a recurring window starting at Start on each of Days and closing at End.
+// An End before Start closes the window on the following day.
+type MaintenanceWindow struct {
+	// Days are the weekdays the window opens on, e.g. "Sat" or "saturday" (default: every day)
+	Days  []string `mapstructure:"days"`
+	Start string   `mapstructure:"start"`
+	End   string   `mapstructure:"end"`
+}
+
+// Enabled reports whether upgrades are restricted to maintenance windows
+func (c MaintenanceConfig) Enabled() bool {
+	return len(c.Windows) > 0
+}
+
+// WindowEnd returns when the maintenance window t falls in closes. It returns false if t is outside
+// every window or on a blackout date. A window running into a blackout date closes when that date starts.
+func (c MaintenanceConfig) WindowEnd(t time.Time) (time.Time, bool) {
+	location := c.location()
+	local := t.In(location)
+	if c.isBlackout(local) {
+		return time.Time{}, false
+	}
+
+	var end time.Time
+	// A window that opened yesterday may still be open
+	for _, dayOffset := range []int{-1, 0} {
+		day := time.Date(local.Year(), local.Month(), local.Day()+dayOffset, 0, 0, 0, 0, location)
+		for _, window := range c.Windows {
+			windowStart, windowEnd, opens := window.on(day)
+			if !opens || local.Before(windowStart) || !local.Before(windowEnd) {
+				continue
+			}
+			windowEnd = c.cutAtBlackout(windowStart, windowEnd)
+			if windowEnd.After(end) {
+				end = windowEnd
+			}
+		}
+	}
+
+	return end, !end.IsZero()
+}
+
+// NextWindowStart returns when the next maintenance window after t opens, looking at most two weeks ahead
+func (c MaintenanceConfig) NextWindowStart(t time.Time) (time.Time, bool) {
+	location := c.location()
+	local := t.In(location)
+
+	var next time.Time
+	for dayOffset := 0; dayOffset <= 14; dayOffset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+dayOffset, 0, 0, 0, 0, location)
+		if c.isBlackout(day) {
+			continue
+		}
+		for _, window := range c.Windows {
+			windowStart, _, opens := window.on(day)
+			if !opens || !windowStart.After(local) {
+				continue
+			}
+			if next.IsZero() || windowStart.Before(next) {
+				next = windowStart
+			}
+		}
+		if !next.IsZero() {
+			return next, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// location returns the configured time zone, which validate has already checked
+func (c MaintenanceConfig) location() *time.Location {
+	if c.Timezone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// isBlackout reports whether t falls on a blackout date
+func (c MaintenanceConfig) isBlackout(t time.Time) bool {
+	date := t.Format(time.DateOnly)
+	for _, blackout := range c.Blackouts {
+		if blackout == date {
+			return true
+		}
+	}
+	return false
+}
+
+// cutAtBlackout moves the end of a window crossing midnight back to the start of a blackout date it runs into
+func (c MaintenanceConfig) cutAtBlackout(start, end time.Time) time.Time {
+	nextDay := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, start.Location())
+	if nextDay.Before(end) && c.isBlackout(nextDay) {
+		return nextDay
+	}
+	return end
+}
+
+// on returns when the window opens and closes if it opens on the given day
+func (w MaintenanceWindow) on(day time.Time) (time.Time, time.Time, bool) {
+	if len(w.Days) > 0 {
+		var matches bool
+		for _, name := range w.Days {
+			if weekday, err := parseWeekday(name); err == nil && weekday == day.Weekday() {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+
+	startClock, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	endClock, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), startClock.Hour(), startClock.Minute(), 0, 0, day.Location())
+	end := time.Date(day.Year(), day.Month(), day.Day(), endClock.Hour(), endClock.Minute(), 0, 0, day.Location())
+	if !end.After(start) {
+		end = time.Date(day.Year(), day.Month(), day.Day()+1, endClock.Hour(), endClock.Minute(), 0, 0, day.Location())
+	}
+
+	return start, end, true
+}
+
+// parseWeekday parses a weekday by its full or three-letter English name, ignoring case
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(name)
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		fullName := strings.ToLower(weekday.String())
+		if name == fullName || name == fullName[:3] {
+			return weekday, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday '%s'", name)
+}
+
+// validate checks the time zone, windows and blackout dates
+func (c MaintenanceConfig) validate() error {
+	if c.Timezone != "" {
+		if _, err := time.LoadLocation(c.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone '%s': %w", c.Timezone, err)
+		}
+	}
+
+	for i, window := range c.Windows {
+		for _, day := range window.Days {
+			if _, err := parseWeekday(day); err != nil {
+				return fmt.Errorf("window %d: %w", i+1, err)
+			}
+		}
+		if _, err := time.Parse("15:04", window.Start); err != nil {
+			return fmt.Errorf("window %d: start must be a time like '22:00', got '%s'", i+1, window.Start)
+		}
+		if _, err := time.Parse("15:04", window.End); err != nil {
+			return fmt.Errorf("window %d: end must be a time like '04:00', got '%s'", i+1, window.End)
+		}
+	}
+
+	for _, blackout := range c.Blackouts {
+		if _, err := time.Parse(time.DateOnly, blackout); err != nil {
+			return fmt.Errorf("blackout date must look like '2025-12-24', got '%s'", blackout)
+		}
+	}
+
+	if c.NodeDuration < 0 {
+		return fmt.Errorf("nodeDuration must not be negative")
+	}
+
+	return nil
+}
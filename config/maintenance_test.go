@@ -0,0 +1,140 @@
+package config
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// at parses a time like "2025-06-07 23:00" in the given location
+func at(t *testing.T, value string, location *time.Location) time.Time {
+	t.Helper()
+
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, location)
+	if err != nil {
+		t.Fatalf("invalid test time %q: %v", value, err)
+	}
+	return parsed
+}
+
+func TestWindowEnd(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	// 2025-06-07 is a Saturday
+	weekend := MaintenanceConfig{
+		Windows: []MaintenanceWindow{
+			{Days: []string{"Sat"}, Start: "22:00", End: "04:00"},
+			{Start: "12:00", End: "13:00"},
+		},
+	}
+	nightly := MaintenanceConfig{
+		Windows:   []MaintenanceWindow{{Start: "22:00", End: "04:00"}},
+		Blackouts: []string{"2025-12-25"},
+	}
+	berlinNightly := MaintenanceConfig{
+		Timezone: "Europe/Berlin",
+		Windows:  []MaintenanceWindow{{Start: "22:00", End: "04:00"}, {Days: []string{"sunday"}, Start: "01:00", End: "04:00"}},
+	}
+
+	tests := []struct {
+		name    string
+		config  MaintenanceConfig
+		t       time.Time
+		wantEnd time.Time
+		wantIn  bool
+	}{
+		{"inside window crossing midnight", weekend, at(t, "2025-06-07 23:00", time.UTC), at(t, "2025-06-08 04:00", time.UTC), true},
+		{"window from the day before still open", weekend, at(t, "2025-06-08 02:00", time.UTC), at(t, "2025-06-08 04:00", time.UTC), true},
+		{"window start is inside", weekend, at(t, "2025-06-07 22:00", time.UTC), at(t, "2025-06-08 04:00", time.UTC), true},
+		{"window end is outside", weekend, at(t, "2025-06-08 04:00", time.UTC), time.Time{}, false},
+		{"before window opens", weekend, at(t, "2025-06-07 21:59", time.UTC), time.Time{}, false},
+		{"other weekday", weekend, at(t, "2025-06-06 23:00", time.UTC), time.Time{}, false},
+		{"daily window", weekend, at(t, "2025-06-10 12:30", time.UTC), at(t, "2025-06-10 13:00", time.UTC), true},
+		{"window cut at blackout date", nightly, at(t, "2025-12-24 23:00", time.UTC), at(t, "2025-12-25 00:00", time.UTC), true},
+		{"window from the day before on blackout date", nightly, at(t, "2025-12-25 01:00", time.UTC), time.Time{}, false},
+		{"window on blackout date", nightly, at(t, "2025-12-25 23:00", time.UTC), time.Time{}, false},
+		{"window after blackout date", nightly, at(t, "2025-12-26 01:00", time.UTC), at(t, "2025-12-26 04:00", time.UTC), true},
+		{"time zone", berlinNightly, at(t, "2025-06-07 20:30", time.UTC), at(t, "2025-06-08 04:00", berlin), true},
+		{"time zone before window", berlinNightly, at(t, "2025-06-07 19:30", time.UTC), time.Time{}, false},
+		{"later end of overlapping windows", berlinNightly, at(t, "2025-06-08 01:30", berlin), at(t, "2025-06-08 04:00", berlin), true},
+		{"daylight saving time starts", berlinNightly, at(t, "2025-03-30 00:30", time.UTC), at(t, "2025-03-30 02:00", time.UTC), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, in := tt.config.WindowEnd(tt.t)
+			if in != tt.wantIn || !end.Equal(tt.wantEnd) {
+				t.Errorf("WindowEnd(%s) = %s, %t, want %s, %t", tt.t, end, in, tt.wantEnd, tt.wantIn)
+			}
+		})
+	}
+}
+
+func TestNextWindowStart(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("failed to load time zone: %v", err)
+	}
+
+	saturdays := MaintenanceConfig{
+		Windows: []MaintenanceWindow{{Days: []string{"saturday"}, Start: "22:00", End: "04:00"}},
+	}
+	blackedOut := saturdays
+	blackedOut.Blackouts = []string{"2025-06-07"}
+	allBlackedOut := saturdays
+	allBlackedOut.Blackouts = []string{"2025-06-07", "2025-06-14", "2025-06-21"}
+
+	tests := []struct {
+		name      string
+		config    MaintenanceConfig
+		t         time.Time
+		wantStart time.Time
+		wantFound bool
+	}{
+		{"later the same week", saturdays, at(t, "2025-06-06 10:00", time.UTC), at(t, "2025-06-07 22:00", time.UTC), true},
+		{"later the same day", saturdays, at(t, "2025-06-07 21:00", time.UTC), at(t, "2025-06-07 22:00", time.UTC), true},
+		{"inside a window", saturdays, at(t, "2025-06-07 23:00", time.UTC), at(t, "2025-06-14 22:00", time.UTC), true},
+		{"window on blackout date is skipped", blackedOut, at(t, "2025-06-06 10:00", time.UTC), at(t, "2025-06-14 22:00", time.UTC), true},
+		{"no window within two weeks", allBlackedOut, at(t, "2025-06-06 10:00", time.UTC), time.Time{}, false},
+		{"earliest of several windows", MaintenanceConfig{
+			Timezone: "Europe/Berlin",
+			Windows:  []MaintenanceWindow{{Start: "22:00", End: "23:00"}, {Start: "03:00", End: "04:00"}},
+		}, at(t, "2025-06-07 00:00", berlin), at(t, "2025-06-07 03:00", berlin), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, found := tt.config.NextWindowStart(tt.t)
+			if found != tt.wantFound || !start.Equal(tt.wantStart) {
+				t.Errorf("NextWindowStart(%s) = %s, %t, want %s, %t", tt.t, start, found, tt.wantStart, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestMaintenanceValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  MaintenanceConfig
+		wantErr bool
+	}{
+		{"valid", MaintenanceConfig{Timezone: "Europe/Berlin", Windows: []MaintenanceWindow{{Days: []string{"Sat", "sunday"}, Start: "22:00", End: "04:00"}}, Blackouts: []string{"2025-12-24"}}, false},
+		{"unknown time zone", MaintenanceConfig{Timezone: "Mars/Olympus"}, true},
+		{"unknown weekday", MaintenanceConfig{Windows: []MaintenanceWindow{{Days: []string{"Caturday"}, Start: "22:00", End: "04:00"}}}, true},
+		{"invalid start", MaintenanceConfig{Windows: []MaintenanceWindow{{Start: "10pm", End: "04:00"}}}, true},
+		{"invalid end", MaintenanceConfig{Windows: []MaintenanceWindow{{Start: "22:00", End: "24:30"}}}, true},
+		{"invalid blackout", MaintenanceConfig{Blackouts: []string{"24.12.2025"}}, true},
+		{"negative node duration", MaintenanceConfig{NodeDuration: -time.Minute}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() = %v, want error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// notificationEvents are the upgrade lifecycle events notifications can be limited to
+var notificationEvents = []string{"started", "node", "error", "completed"}
+
+// NotificationsConfig represents where upgrade lifecycle notifications are sent. Without backends, none are sent.
+type NotificationsConfig struct {
+	Webhooks []WebhookConfig `mapstructure:"webhooks"`
+	Email    EmailConfig     `mapstructure:"email"`
+	// Timeout bounds the delivery of a single notification to a single backend (default: 10s)
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// WebhookConfig represents an HTTP endpoint notifications are posted to
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+	// Format is the payload format: "json" (default), "slack" or "discord"
+	Format string `mapstructure:"format"`
+	// Headers are added to every request, e.g. for authorization
+	Headers map[string]string `mapstructure:"headers"`
+	// Events limits the notifications sent, e.g. ["error", "completed"] (default: all)
+	Events []string `mapstructure:"events"`
+}
+
+// EmailConfig represents an SMTP server notifications are mailed through
+type EmailConfig struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// Events limits the notifications sent, e.g. ["error", "completed"] (default: all)
+	Events []string `mapstructure:"events"`
+}
+
+// Enabled reports whether notifications are mailed
+func (e EmailConfig) Enabled() bool {
+	return e.Host != ""
+}
+
+// validate checks the webhooks and the email settings
+func (c NotificationsConfig) validate() error {
+	for i, webhook := range c.Webhooks {
+		parsed, err := url.Parse(webhook.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("webhook %d: url must be an http or https URL", i+1)
+		}
+		if webhook.Format != "json" && webhook.Format != "slack" && webhook.Format != "discord" {
+			return fmt.Errorf("webhook %d: format must be 'json', 'slack' or 'discord', got '%s'", i+1, webhook.Format)
+		}
+		if err := validateNotificationEvents(webhook.Events); err != nil {
+			return fmt.Errorf("webhook %d: %w", i+1, err)
+		}
+	}
+
+	if c.Email.Enabled() {
+		if c.Email.From == "" || len(c.Email.To) == 0 {
+			return fmt.Errorf("email needs a from address and at least one to address")
+		}
+		if c.Email.Port <= 0 || c.Email.Port > 65535 {
+			return fmt.Errorf("email port must be between 1 and 65535, got %d", c.Email.Port)
+		}
+		if err := validateNotificationEvents(c.Email.Events); err != nil {
+			return fmt.Errorf("email: %w", err)
+		}
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+
+	return nil
+}
+
+// validateNotificationEvents checks that events only names known lifecycle events
+func validateNotificationEvents(events []string) error {
+	for _, event := range events {
+		if !slices.Contains(notificationEvents, event) {
+			return fmt.Errorf("unknown event '%s': must be one of %v", event, notificationEvents)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultFactoryURL is the public Talos Image Factory
+const DefaultFactoryURL = "https://factory.talos.dev"
+
+// SchematicConfig declares the customization of the Talos installer image. Its schematic ID is
+// obtained from an Image Factory and used instead of talos.imageId.
+type SchematicConfig struct {
+	// FactoryURL is the Image Factory the schematic is registered with and the installer is pulled from
+	FactoryURL string `mapstructure:"factoryUrl"`
+	// Extensions are official system extensions, e.g. siderolabs/iscsi-tools
+	Extensions      []string         `mapstructure:"extensions"`
+	ExtraKernelArgs []string         `mapstructure:"extraKernelArgs"`
+	Overlay         SchematicOverlay `mapstructure:"overlay"`
+	// CachePath is the file schematic IDs are cached in, so that unchanged schematics are not registered again
+	CachePath string `mapstructure:"cachePath"`
+}
+
+// SchematicOverlay is the board overlay of a schematic, used by single board computers
+type SchematicOverlay struct {
+	// Name is the overlay within the image, e.g. rpi_generic
+	Name string `mapstructure:"name"`
+	// Image is the overlay image, e.g. siderolabs/sbc-raspberrypi
+	Image string `mapstructure:"image"`
+}
+
+// IsEmpty returns true if no customization is declared
+func (s SchematicConfig) IsEmpty() bool {
+	return len(s.Extensions) == 0 && len(s.ExtraKernelArgs) == 0 && s.Overlay.Name == "" && s.Overlay.Image == ""
+}
+
+// validate checks the factory URL and that an overlay has both a name and an image
+func (s SchematicConfig) validate() error {
+	parsed, err := url.Parse(s.FactoryURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("factoryUrl must be an http or https URL")
+	}
+
+	if (s.Overlay.Name == "") != (s.Overlay.Image == "") {
+		return fmt.Errorf("overlay needs both a name and an image")
+	}
+
+	for _, extension := range s.Extensions {
+		if strings.TrimSpace(extension) == "" {
+			return fmt.Errorf("extensions must not be empty")
+		}
+	}
+
+	return nil
+}
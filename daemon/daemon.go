@@ -0,0 +1,432 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/metrics"
+	"github.com/bouquet2/water/notify"
+	"github.com/bouquet2/water/talos"
+	"github.com/bouquet2/water/upgrade"
+	"github.com/rs/zerolog/log"
+)
+
+// Reconciliation outcomes reported in Status.LastResult
+const (
+	ResultUpToDate         = "up-to-date"
+	ResultDrift            = "drift"
+	ResultWaitingForWindow = "waiting-for-maintenance-window"
+	ResultUpgraded         = "upgraded"
+	ResultUpgradeFailed    = "upgrade-failed"
+	ResultUpgradeHeld      = "upgrade-held"
+	ResultError            = "error"
+)
+
+// Daemon states reported in Status.State
+const (
+	stateIdle      = "idle"
+	stateChecking  = "checking"
+	stateUpgrading = "upgrading"
+)
+
+// shutdownTimeout bounds how long the status server may take to shut down
+const shutdownTimeout = 10 * time.Second
+
+// Options configures the daemon
+type Options struct {
+	// LoadConfig reads the configuration afresh, it is called at the start of every reconciliation
+	LoadConfig func() (*config.Config, error)
+	// JournalPath returns where the upgrade journal of a configuration is written
+	JournalPath     func(cfg *config.Config) string
+	TalosConfigPath string
+	// Interval is the time between the end of one reconciliation and the start of the next
+	Interval time.Duration
+	// ListenAddress serves the status endpoints, an empty address disables them
+	ListenAddress string
+	// AutoUpgrade performs upgrades when drift is found, otherwise drift is only reported
+	AutoUpgrade bool
+	// Metrics records every reconciliation and is served on /metrics next to the status endpoints
+	Metrics *metrics.Collector
+}
+
+// Status describes what the daemon is doing and how its last reconciliation went
+type Status struct {
+	State               string               `json:"state"`
+	LastRunStarted      time.Time            `json:"lastRunStarted,omitzero"`
+	LastRunFinished     time.Time            `json:"lastRunFinished,omitzero"`
+	LastResult          string               `json:"lastResult,omitempty"`
+	LastError           string               `json:"lastError,omitempty"`
+	LastSuccess         time.Time            `json:"lastSuccess,omitzero"`
+	ConsecutiveFailures int                  `json:"consecutiveFailures"`
+	NextRun             time.Time            `json:"nextRun,omitzero"`
+	Check               *upgrade.CheckResult `json:"check,omitempty"`
+	Upgrade             *UpgradeSummary      `json:"upgrade,omitempty"`
+	Hold                *UpgradeHold         `json:"hold,omitempty"`
+}
+
+// UpgradeTargets are the versions and installer images an upgrade works towards
+type UpgradeTargets struct {
+	TalosVersion string `json:"talosVersion"`
+	K8sVersion   string `json:"k8sVersion"`
+	ImageID      string `json:"imageId,omitempty"`
+	// ImageOverrides and Schematic tell targets apart too, they are left out of the status
+	ImageOverrides []config.ImageOverride `json:"-"`
+	Schematic      config.SchematicConfig `json:"-"`
+}
+
+// UpgradeHold keeps the daemon from upgrading again to targets whose upgrade failed. It is released
+// when the configured targets change, the cluster reaches them or DELETE /hold is called.
+type UpgradeHold struct {
+	Targets UpgradeTargets `json:"targets"`
+	Since   time.Time      `json:"since"`
+	Error   string         `json:"error"`
+}
+
+// UpgradeSummary is the outcome of the last upgrade the daemon performed
+type UpgradeSummary struct {
+	TalosUpgraded bool     `json:"talosUpgraded"`
+	K8sUpgraded   bool     `json:"k8sUpgraded"`
+	NodesUpgraded []string `json:"nodesUpgraded,omitempty"`
+	FailedNodes   []string `json:"failedNodes,omitempty"`
+	Errors        []string `json:"errors,omitempty"`
+	Duration      string   `json:"duration"`
+}
+
+// Daemon periodically compares the cluster with the configured versions and upgrades it when it drifts
+type Daemon struct {
+	opts Options
+
+	mu     sync.RWMutex
+	status Status
+}
+
+// New creates a new daemon
+func New(opts Options) *Daemon {
+	return &Daemon{
+		opts:   opts,
+		status: Status{State: stateIdle},
+	}
+}
+
+// Status returns a copy of the current status
+func (d *Daemon) Status() Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.status
+}
+
+// Run reconciles until ctx is cancelled. An upgrade in progress when ctx is cancelled finishes the nodes
+// it is working on and then stops, so that no node is left half upgraded; the journal lets the next start
+// continue from there.
+func (d *Daemon) Run(ctx context.Context) error {
+	var server *http.Server
+	serverErr := make(chan error, 1)
+	if d.opts.ListenAddress != "" {
+		server = &http.Server{
+			Addr:              d.opts.ListenAddress,
+			Handler:           d.handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		go func() {
+			log.Info().Str("address", d.opts.ListenAddress).Msg("Serving daemon status")
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
+	log.Info().
+		Dur("interval", d.opts.Interval).
+		Bool("auto_upgrade", d.opts.AutoUpgrade).
+		Msg("Starting water daemon")
+
+	for {
+		d.reconcile(ctx)
+
+		next := time.Now().Add(d.opts.Interval)
+		d.mu.Lock()
+		d.status.NextRun = next
+		d.mu.Unlock()
+
+		log.Info().Time("next_run", next).Msg("Waiting for next reconciliation")
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Shutting down water daemon")
+			if server != nil {
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				if err := server.Shutdown(shutdownCtx); err != nil {
+					log.Error().Err(err).Msg("Failed to shut down status server")
+				}
+				cancel()
+			}
+			return nil
+		case err := <-serverErr:
+			return fmt.Errorf("status server failed: %w", err)
+		case <-time.After(d.opts.Interval):
+		}
+	}
+}
+
+// handler serves the status endpoints
+func (d *Daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+	})
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(d.Status()); err != nil {
+			log.Error().Err(err).Msg("Failed to encode daemon status")
+		}
+	})
+
+	mux.HandleFunc("DELETE /hold", func(w http.ResponseWriter, _ *http.Request) {
+		d.releaseHold("released through the status endpoint")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	if d.opts.Metrics != nil {
+		mux.Handle("/metrics", d.opts.Metrics)
+	}
+
+	return mux
+}
+
+// setState records what the daemon is currently doing
+func (d *Daemon) setState(state string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.status.State = state
+}
+
+// finish records the outcome of a reconciliation
+func (d *Daemon) finish(result string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.status.State = stateIdle
+	d.status.LastRunFinished = time.Now()
+	d.status.LastResult = result
+	d.status.LastError = ""
+
+	if err != nil {
+		d.status.LastError = err.Error()
+		d.status.ConsecutiveFailures++
+		message := "Reconciliation failed, will retry at the next interval"
+		if d.status.Hold != nil {
+			message = "Reconciliation failed, upgrades are held until the targets change or the hold is released"
+		}
+		log.Error().
+			Err(err).
+			Str("result", result).
+			Int("consecutive_failures", d.status.ConsecutiveFailures).
+			Msg(message)
+		return
+	}
+
+	// A held upgrade is neither a new failure nor a success
+	if result == ResultUpgradeHeld {
+		return
+	}
+
+	d.status.ConsecutiveFailures = 0
+	d.status.LastSuccess = d.status.LastRunFinished
+	log.Info().Str("result", result).Msg("Reconciliation completed")
+}
+
+// targetsOf returns the upgrade targets of a configuration
+func targetsOf(cfg *config.Config) UpgradeTargets {
+	return UpgradeTargets{
+		TalosVersion:   cfg.Talos.Version,
+		K8sVersion:     cfg.K8s.Version,
+		ImageID:        cfg.Talos.ImageID,
+		ImageOverrides: cfg.Talos.ImageOverrides,
+		Schematic:      cfg.Talos.Schematic,
+	}
+}
+
+// heldFor returns the hold on targets, releasing a hold on other targets
+func (d *Daemon) heldFor(targets UpgradeTargets) *UpgradeHold {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.status.Hold != nil && !reflect.DeepEqual(d.status.Hold.Targets, targets) {
+		log.Info().
+			Str("held_talos", d.status.Hold.Targets.TalosVersion).
+			Str("held_k8s", d.status.Hold.Targets.K8sVersion).
+			Msg("Configured targets changed, releasing the upgrade hold")
+		d.status.Hold = nil
+	}
+	return d.status.Hold
+}
+
+// hold stops further upgrades to targets after their upgrade failed
+func (d *Daemon) hold(targets UpgradeTargets, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.status.Hold = &UpgradeHold{Targets: targets, Since: time.Now(), Error: err.Error()}
+	log.Warn().
+		Str("target_talos", targets.TalosVersion).
+		Str("target_k8s", targets.K8sVersion).
+		Msg("Holding upgrades to the failed targets until they change or the hold is released")
+}
+
+// releaseHold lets upgrades run again
+func (d *Daemon) releaseHold(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.status.Hold == nil {
+		return
+	}
+	d.status.Hold = nil
+	log.Info().Str("reason", reason).Msg("Upgrade hold released")
+}
+
+// reconcile runs one check, and an upgrade if the cluster drifted. Errors, including panics,
+// are recorded in the status instead of stopping the daemon.
+func (d *Daemon) reconcile(ctx context.Context) {
+	d.mu.Lock()
+	d.status.State = stateChecking
+	d.status.LastRunStarted = time.Now()
+	d.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			d.finish(ResultError, fmt.Errorf("reconciliation panicked: %v", r))
+		}
+	}()
+
+	result, err := d.runOnce(ctx)
+	d.finish(result, err)
+}
+
+// runOnce re-reads the configuration, checks the cluster and upgrades it if needed and allowed
+func (d *Daemon) runOnce(ctx context.Context) (string, error) {
+	cfg, err := d.opts.LoadConfig()
+	if err != nil {
+		return ResultError, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	talosClient, err := talos.NewClient(d.opts.TalosConfigPath)
+	if err != nil {
+		return ResultError, fmt.Errorf("failed to create Talos client: %w", err)
+	}
+	defer func() {
+		if err := talosClient.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close Talos client")
+		}
+	}()
+
+	upgradeManager := upgrade.NewManager(talosClient, cfg)
+	if d.opts.Metrics != nil {
+		upgradeManager.AddEventHandler(d.opts.Metrics.HandleEvent)
+	}
+
+	// Shutting down stops the upgrade once the nodes in progress are done instead of cutting them short
+	stopOnShutdown := context.AfterFunc(ctx, upgradeManager.Stop)
+	defer stopOnShutdown()
+	ctx = context.WithoutCancel(ctx)
+
+	check, err := upgradeManager.Check(ctx)
+	if err != nil {
+		return ResultError, fmt.Errorf("version check failed: %w", err)
+	}
+
+	d.mu.Lock()
+	d.status.Check = check
+	d.mu.Unlock()
+
+	if !check.NeedsUpgrade() {
+		d.releaseHold("cluster runs the configured versions")
+		return ResultUpToDate, nil
+	}
+
+	log.Info().
+		Str("current_talos", check.CurrentTalos).
+		Str("target_talos", check.TargetTalos).
+		Str("current_k8s", check.CurrentK8s).
+		Str("target_k8s", check.TargetK8s).
+		Msg("Cluster drifted from the configured versions")
+
+	if !d.opts.AutoUpgrade {
+		return ResultDrift, nil
+	}
+
+	// Upgrading again to targets that failed would drain, reboot and possibly roll back the same
+	// nodes every interval
+	targets := targetsOf(cfg)
+	if hold := d.heldFor(targets); hold != nil {
+		log.Warn().
+			Time("held_since", hold.Since).
+			Str("error", hold.Error).
+			Msg("Upgrade to these targets failed before - skipping until they change or the hold is released")
+		return ResultUpgradeHeld, nil
+	}
+
+	if cfg.Maintenance.Enabled() {
+		if _, open := cfg.Maintenance.WindowEnd(time.Now()); !open {
+			log.Info().Msg("Outside maintenance window - upgrade postponed")
+			return ResultWaitingForWindow, nil
+		}
+	}
+
+	// Continue an upgrade an earlier reconciliation or a restart left unfinished
+	journalPath := d.opts.JournalPath(cfg)
+	journal, err := upgrade.OpenJournal(journalPath, upgrade.CanResumeJournal(journalPath, cfg), cfg)
+	if err != nil {
+		return ResultError, fmt.Errorf("failed to open upgrade journal: %w", err)
+	}
+	upgradeManager.SetJournal(journal)
+
+	notifier := notify.New(cfg.Notifications)
+	defer notifier.Close()
+	upgradeManager.AddEventHandler(notifier.HandleEvent)
+
+	d.setState(stateUpgrading)
+	upgradeResult, err := upgradeManager.PerformUpgrade(ctx)
+	if upgradeResult != nil {
+		summary := &UpgradeSummary{
+			TalosUpgraded: upgradeResult.TalosUpgraded,
+			K8sUpgraded:   upgradeResult.K8sUpgraded,
+			NodesUpgraded: upgradeResult.NodesUpgraded,
+			FailedNodes:   upgradeResult.FailedNodes,
+			Duration:      upgradeResult.UpgradeDuration.String(),
+		}
+		for _, upgradeErr := range upgradeResult.Errors {
+			summary.Errors = append(summary.Errors, upgradeErr.Error())
+		}
+
+		d.mu.Lock()
+		d.status.Upgrade = summary
+		d.mu.Unlock()
+	}
+
+	if err == nil && upgradeResult.HasErrors() {
+		err = fmt.Errorf("upgrade completed with %d errors", len(upgradeResult.Errors))
+	}
+	if err != nil {
+		// An interrupted upgrade continues from its journal at the next start
+		if upgradeResult == nil || !upgradeResult.Interrupted {
+			d.hold(targets, err)
+		}
+		return ResultUpgradeFailed, err
+	}
+
+	return ResultUpgraded, nil
+}
@@ -0,0 +1,218 @@
+package factory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/rs/zerolog/log"
+	"sigs.k8s.io/yaml"
+)
+
+// maxErrorBody bounds how much of an error response is quoted in the returned error
+const maxErrorBody = 1024
+
+// Schematic is the customization of a Talos image in the format the Image Factory accepts
+type Schematic struct {
+	Overlay       *Overlay      `json:"overlay,omitempty"`
+	Customization Customization `json:"customization,omitzero"`
+}
+
+// Overlay is the board overlay of a schematic
+type Overlay struct {
+	Image string `json:"image"`
+	Name  string `json:"name"`
+}
+
+// Customization holds the kernel arguments and system extensions of a schematic
+type Customization struct {
+	ExtraKernelArgs  []string         `json:"extraKernelArgs,omitempty"`
+	SystemExtensions SystemExtensions `json:"systemExtensions,omitzero"`
+}
+
+// SystemExtensions lists the official system extensions of a schematic
+type SystemExtensions struct {
+	OfficialExtensions []string `json:"officialExtensions,omitempty"`
+}
+
+// SchematicFromConfig builds the schematic declared in talos.schematic
+func SchematicFromConfig(cfg config.SchematicConfig) Schematic {
+	schematic := Schematic{
+		Customization: Customization{
+			ExtraKernelArgs:  cfg.ExtraKernelArgs,
+			SystemExtensions: SystemExtensions{OfficialExtensions: cfg.Extensions},
+		},
+	}
+	if cfg.Overlay.Image != "" {
+		schematic.Overlay = &Overlay{Image: cfg.Overlay.Image, Name: cfg.Overlay.Name}
+	}
+	return schematic
+}
+
+// Client registers schematics with an Image Factory and remembers their IDs
+type Client struct {
+	url       string
+	cachePath string
+	client    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// NewClient creates a client for the Image Factory at factoryURL. Schematic IDs are cached in cachePath,
+// or in ~/.water/schematics.json if it is empty.
+func NewClient(factoryURL, cachePath string) *Client {
+	if cachePath == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			cachePath = filepath.Join(homeDir, ".water", "schematics.json")
+		}
+	}
+
+	return &Client{
+		url:       strings.TrimSuffix(factoryURL, "/"),
+		cachePath: cachePath,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SchematicID returns the ID of schematic, registering it with the Image Factory unless it is cached
+func (c *Client) SchematicID(ctx context.Context, schematic Schematic) (string, error) {
+	body, err := yaml.Marshal(schematic)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode schematic: %w", err)
+	}
+
+	// The same schematic registered with another factory may have another ID
+	sum := sha256.Sum256(append([]byte(c.url+"\n"), body...))
+	key := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cache == nil {
+		c.cache = c.loadCache()
+	}
+	if id, ok := c.cache[key]; ok {
+		log.Debug().Str("schematic_id", id).Str("factory", c.url).Msg("Using cached schematic ID")
+		return id, nil
+	}
+
+	id, err := c.register(ctx, body)
+	if err != nil {
+		return "", err
+	}
+
+	log.Info().Str("schematic_id", id).Str("factory", c.url).Msg("Schematic registered with Image Factory")
+
+	c.cache[key] = id
+	if err := c.saveCache(); err != nil {
+		log.Warn().Err(err).Str("cache", c.cachePath).Msg("Failed to cache schematic ID")
+	}
+
+	return id, nil
+}
+
+// InstallerImage returns the installer image of a schematic ID, without version. The registry is the
+// factory host, including its port and any path prefix the factory is served under.
+func (c *Client) InstallerImage(id string) string {
+	repository := c.url
+	if parsed, err := url.Parse(c.url); err == nil && parsed.Host != "" {
+		repository = parsed.Host + strings.TrimSuffix(parsed.Path, "/")
+	}
+	return repository + "/installer/" + id
+}
+
+// register posts a schematic to the Image Factory and returns the ID it was given
+func (c *Client) register(ctx context.Context, body []byte) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/schematics", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create schematic request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/yaml")
+
+	response, err := c.client.Do(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to post schematic to %s: %w", c.url, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBody))
+		return "", fmt.Errorf("image factory %s rejected the schematic with status %s: %s",
+			c.url, response.Status, strings.TrimSpace(string(message)))
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("failed to decode schematic response from %s: %w", c.url, err)
+	}
+	if created.ID == "" {
+		return "", fmt.Errorf("image factory %s returned no schematic ID", c.url)
+	}
+
+	return created.ID, nil
+}
+
+// loadCache reads the cached schematic IDs, starting empty if there are none or they cannot be read
+func (c *Client) loadCache() map[string]string {
+	cache := make(map[string]string)
+	if c.cachePath == "" {
+		return cache
+	}
+
+	data, err := os.ReadFile(c.cachePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("cache", c.cachePath).Msg("Failed to read schematic cache")
+		}
+		return cache
+	}
+
+	if err := json.Unmarshal(data, &cache); err != nil {
+		log.Warn().Err(err).Str("cache", c.cachePath).Msg("Ignoring unreadable schematic cache")
+		return make(map[string]string)
+	}
+
+	return cache
+}
+
+// saveCache writes the cached schematic IDs atomically by replacing the file with a fully written copy
+func (c *Client) saveCache() error {
+	if c.cachePath == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.cachePath), 0o700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c.cache, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schematic cache: %w", err)
+	}
+
+	tmpPath := c.cachePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write schematic cache: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, c.cachePath); err != nil {
+		return fmt.Errorf("failed to replace schematic cache: %w", err)
+	}
+
+	return nil
+}
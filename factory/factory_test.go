@@ -0,0 +1,198 @@
+package factory
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bouquet2/water/config"
+)
+
+// standIn is a local Image Factory that answers every schematic with the same response and counts the requests
+type standIn struct {
+	server   *httptest.Server
+	requests atomic.Int32
+	body     atomic.Value
+}
+
+func newStandIn(t *testing.T, status int, response string) *standIn {
+	t.Helper()
+
+	s := &standIn{}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/schematics" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		s.body.Store(string(body))
+		s.requests.Add(1)
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	t.Cleanup(s.server.Close)
+
+	return s
+}
+
+var testSchematic = SchematicFromConfig(config.SchematicConfig{
+	Extensions:      []string{"siderolabs/iscsi-tools", "siderolabs/util-linux-tools"},
+	ExtraKernelArgs: []string{"net.ifnames=0"},
+	Overlay:         config.SchematicOverlay{Name: "rpi_generic", Image: "siderolabs/sbc-raspberrypi"},
+})
+
+func TestSchematicIDPostsSchematic(t *testing.T) {
+	factory := newStandIn(t, http.StatusCreated, `{"id":"376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba"}`)
+	client := NewClient(factory.server.URL, filepath.Join(t.TempDir(), "schematics.json"))
+
+	id, err := client.SchematicID(context.Background(), testSchematic)
+	if err != nil {
+		t.Fatalf("SchematicID: %v", err)
+	}
+	if id != "376567988ad370138ad8b2698212367b8edcb69b5fd68c80be1f2ec7d603b4ba" {
+		t.Errorf("id = %q", id)
+	}
+
+	want := `customization:
+  extraKernelArgs:
+  - net.ifnames=0
+  systemExtensions:
+    officialExtensions:
+    - siderolabs/iscsi-tools
+    - siderolabs/util-linux-tools
+overlay:
+  image: siderolabs/sbc-raspberrypi
+  name: rpi_generic
+`
+	if got := factory.body.Load(); got != want {
+		t.Errorf("posted schematic:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSchematicIDOmitsUnsetCustomization(t *testing.T) {
+	factory := newStandIn(t, http.StatusCreated, `{"id":"abc"}`)
+	client := NewClient(factory.server.URL, "")
+	client.cachePath = ""
+
+	schematic := SchematicFromConfig(config.SchematicConfig{Extensions: []string{"siderolabs/iscsi-tools"}})
+	if _, err := client.SchematicID(context.Background(), schematic); err != nil {
+		t.Fatalf("SchematicID: %v", err)
+	}
+
+	body := factory.body.Load().(string)
+	if strings.Contains(body, "overlay") || strings.Contains(body, "extraKernelArgs") {
+		t.Errorf("posted schematic has unset fields:\n%s", body)
+	}
+}
+
+func TestSchematicIDErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		want     string
+	}{
+		{"rejected", http.StatusBadRequest, "unknown extension siderolabs/nope", "rejected the schematic with status 400 Bad Request: unknown extension siderolabs/nope"},
+		{"server error", http.StatusInternalServerError, "", "status 500"},
+		{"not json", http.StatusCreated, "<html>", "failed to decode schematic response"},
+		{"no id", http.StatusCreated, `{}`, "returned no schematic ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factory := newStandIn(t, tt.status, tt.response)
+			cachePath := filepath.Join(t.TempDir(), "schematics.json")
+
+			_, err := NewClient(factory.server.URL, cachePath).SchematicID(context.Background(), testSchematic)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.want)
+			}
+
+			// Failures are not cached, the next client asks the factory again
+			_, _ = NewClient(factory.server.URL, cachePath).SchematicID(context.Background(), testSchematic)
+			if got := factory.requests.Load(); got != 2 {
+				t.Errorf("factory got %d requests, want 2", got)
+			}
+		})
+	}
+}
+
+func TestSchematicIDCache(t *testing.T) {
+	factory := newStandIn(t, http.StatusCreated, `{"id":"abc"}`)
+	cachePath := filepath.Join(t.TempDir(), "schematics.json")
+
+	client := NewClient(factory.server.URL, cachePath)
+	for range 2 {
+		if _, err := client.SchematicID(context.Background(), testSchematic); err != nil {
+			t.Fatalf("SchematicID: %v", err)
+		}
+	}
+	if got := factory.requests.Load(); got != 1 {
+		t.Fatalf("factory got %d requests for the same schematic, want 1", got)
+	}
+
+	// A new client finds the ID in the cache file
+	id, err := NewClient(factory.server.URL, cachePath).SchematicID(context.Background(), testSchematic)
+	if err != nil || id != "abc" {
+		t.Fatalf("SchematicID from cache = %q, %v", id, err)
+	}
+	if got := factory.requests.Load(); got != 1 {
+		t.Fatalf("factory got %d requests with a cache file, want 1", got)
+	}
+
+	// Another schematic is a cache miss
+	other := SchematicFromConfig(config.SchematicConfig{Extensions: []string{"siderolabs/gvisor"}})
+	if _, err := client.SchematicID(context.Background(), other); err != nil {
+		t.Fatalf("SchematicID: %v", err)
+	}
+	if got := factory.requests.Load(); got != 2 {
+		t.Fatalf("factory got %d requests after another schematic, want 2", got)
+	}
+}
+
+func TestSchematicIDCachePerFactory(t *testing.T) {
+	first := newStandIn(t, http.StatusCreated, `{"id":"first"}`)
+	second := newStandIn(t, http.StatusCreated, `{"id":"second"}`)
+	cachePath := filepath.Join(t.TempDir(), "schematics.json")
+
+	for _, tt := range []struct {
+		factory *standIn
+		want    string
+	}{{first, "first"}, {second, "second"}, {first, "first"}} {
+		id, err := NewClient(tt.factory.server.URL, cachePath).SchematicID(context.Background(), testSchematic)
+		if err != nil {
+			t.Fatalf("SchematicID: %v", err)
+		}
+		if id != tt.want {
+			t.Errorf("id from %s = %q, want %q", tt.factory.server.URL, id, tt.want)
+		}
+	}
+
+	if first.requests.Load() != 1 || second.requests.Load() != 1 {
+		t.Errorf("factories got %d and %d requests, want 1 each", first.requests.Load(), second.requests.Load())
+	}
+}
+
+func TestInstallerImage(t *testing.T) {
+	tests := []struct {
+		factoryURL string
+		want       string
+	}{
+		{"https://factory.talos.dev", "factory.talos.dev/installer/abc"},
+		{"https://factory.talos.dev/", "factory.talos.dev/installer/abc"},
+		{"http://localhost:8080", "localhost:8080/installer/abc"},
+		{"https://registry.example.com/talos/factory", "registry.example.com/talos/factory/installer/abc"},
+		{"https://registry.example.com:5000/factory/", "registry.example.com:5000/factory/installer/abc"},
+	}
+
+	for _, tt := range tests {
+		if got := NewClient(tt.factoryURL, "").InstallerImage("abc"); got != tt.want {
+			t.Errorf("InstallerImage with %s = %q, want %q", tt.factoryURL, got, tt.want)
+		}
+	}
+}
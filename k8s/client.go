@@ -11,6 +11,7 @@ import (
 	"github.com/rs/zerolog/log"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -18,8 +19,9 @@ import (
 
 // Client wraps the Kubernetes client with additional functionality
 type Client struct {
-	clientset *kubernetes.Clientset
-	config    *rest.Config
+	clientset     *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	config        *rest.Config
 }
 
 var (
@@ -62,11 +64,18 @@ func NewClientWithKubeconfig(kubeconfigPath string) (*Client, error) {
 		return nil, fmt.Errorf("failed to create Kubernetes clientset: %w", err)
 	}
 
+	// The dynamic client serves custom resources such as ClusterUpgrade
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes dynamic client: %w", err)
+	}
+
 	log.Info().Msg("Kubernetes client created successfully")
 
 	return &Client{
-		clientset: clientset,
-		config:    config,
+		clientset:     clientset,
+		dynamicClient: dynamicClient,
+		config:        config,
 	}, nil
 }
 
@@ -293,6 +302,8 @@ func GetNodeInfo(ctx context.Context, nodeName string) (*NodeInfo, error) {
 		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
 		OSImage:        node.Status.NodeInfo.OSImage,
 		Architecture:   node.Status.NodeInfo.Architecture,
+		Labels:         node.Labels,
+		Annotations:    node.Annotations,
 	}, nil
 }
 
@@ -304,6 +315,8 @@ type NodeInfo struct {
 	KubeletVersion string
 	OSImage        string
 	Architecture   string
+	Labels         map[string]string
+	Annotations    map[string]string
 }
 
 // GetClusterInfo retrieves comprehensive cluster information
@@ -350,6 +363,8 @@ func GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
 			KubeletVersion: node.Status.NodeInfo.KubeletVersion,
 			OSImage:        node.Status.NodeInfo.OSImage,
 			Architecture:   node.Status.NodeInfo.Architecture,
+			Labels:         node.Labels,
+			Annotations:    node.Annotations,
 		})
 	}
 
@@ -0,0 +1,73 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/retry"
+)
+
+// ClusterUpgradeResource identifies the cluster-scoped ClusterUpgrade custom resource
+var ClusterUpgradeResource = schema.GroupVersionResource{
+	Group:    "water.bouquet2",
+	Version:  "v1alpha1",
+	Resource: "clusterupgrades",
+}
+
+// ListClusterUpgrades retrieves all ClusterUpgrade resources
+func ListClusterUpgrades(ctx context.Context) (*unstructured.UnstructuredList, error) {
+	client, err := GetSharedClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	list, err := client.dynamicClient.Resource(ClusterUpgradeResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ClusterUpgrades: %w", err)
+	}
+
+	return list, nil
+}
+
+// WatchClusterUpgrades watches ClusterUpgrade resources for changes after resourceVersion. An empty
+// resourceVersion starts with an ADDED event for every existing ClusterUpgrade.
+func WatchClusterUpgrades(ctx context.Context, resourceVersion string) (watch.Interface, error) {
+	client, err := GetSharedClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	watcher, err := client.dynamicClient.Resource(ClusterUpgradeResource).Watch(ctx, metav1.ListOptions{ResourceVersion: resourceVersion})
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch ClusterUpgrades: %w", err)
+	}
+
+	return watcher, nil
+}
+
+// UpdateClusterUpgradeStatus replaces the status of a ClusterUpgrade, retrying on update conflicts
+func UpdateClusterUpgradeStatus(ctx context.Context, name string, status map[string]interface{}) error {
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	resource := client.dynamicClient.Resource(ClusterUpgradeResource)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		clusterUpgrade, err := resource.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get ClusterUpgrade %s: %w", name, err)
+		}
+
+		if err := unstructured.SetNestedField(clusterUpgrade.Object, status, "status"); err != nil {
+			return fmt.Errorf("failed to set status of ClusterUpgrade %s: %w", name, err)
+		}
+
+		_, err = resource.UpdateStatus(ctx, clusterUpgrade, metav1.UpdateOptions{})
+		return err
+	})
+}
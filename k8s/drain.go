@@ -0,0 +1,282 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/util/retry"
+)
+
+// mirrorPodAnnotation marks static pods mirrored into the API server by the kubelet
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// DrainOptions controls how pods are evicted from a node
+type DrainOptions struct {
+	// Timeout bounds the whole drain, including waiting for evicted pods to terminate
+	Timeout time.Duration
+	// GracePeriod overrides the pods' termination grace period; zero keeps each pod's own value
+	GracePeriod time.Duration
+	// IgnoreDaemonSets skips DaemonSet-managed pods instead of refusing to drain
+	IgnoreDaemonSets bool
+	// DeleteEmptyDirData allows evicting pods that use emptyDir volumes, losing their data
+	DeleteEmptyDirData bool
+	// Force allows evicting pods that are not managed by a controller
+	Force bool
+}
+
+// CordonNode marks a node as unschedulable
+func CordonNode(ctx context.Context, nodeName string) error {
+	log.Info().Str("node", nodeName).Msg("Cordoning node")
+	return setNodeUnschedulable(ctx, nodeName, true)
+}
+
+// UncordonNode marks a node as schedulable again
+func UncordonNode(ctx context.Context, nodeName string) error {
+	log.Info().Str("node", nodeName).Msg("Uncordoning node")
+	return setNodeUnschedulable(ctx, nodeName, false)
+}
+
+// setNodeUnschedulable updates the unschedulable flag of a node, retrying on update conflicts
+func setNodeUnschedulable(ctx context.Context, nodeName string, unschedulable bool) error {
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := client.clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get node %s: %w", nodeName, err)
+		}
+
+		if node.Spec.Unschedulable == unschedulable {
+			return nil
+		}
+
+		node.Spec.Unschedulable = unschedulable
+		_, err = client.clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// DrainNode evicts all pods from a node using the eviction API, so that PodDisruptionBudgets are respected.
+// The node should be cordoned first, otherwise evicted pods may be rescheduled onto it.
+func DrainNode(ctx context.Context, nodeName string, opts DrainOptions) error {
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	log.Info().
+		Str("node", nodeName).
+		Dur("timeout", opts.Timeout).
+		Bool("ignore_daemonsets", opts.IgnoreDaemonSets).
+		Bool("delete_emptydir_data", opts.DeleteEmptyDirData).
+		Bool("force", opts.Force).
+		Msg("Draining node")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	podList, err := client.clientset.CoreV1().Pods(metav1.NamespaceAll).List(timeoutCtx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	// Decide which pods to evict before touching anything, so a blocked drain leaves the node untouched
+	var toEvict []corev1.Pod
+	var blocked []string
+	for _, pod := range podList.Items {
+		evict, reason := drainDecision(pod, opts)
+		if reason != "" {
+			blocked = append(blocked, fmt.Sprintf("%s/%s (%s)", pod.Namespace, pod.Name, reason))
+			continue
+		}
+		if evict {
+			toEvict = append(toEvict, pod)
+		}
+	}
+
+	if len(blocked) > 0 {
+		return fmt.Errorf("cannot drain node %s: %s", nodeName, strings.Join(blocked, ", "))
+	}
+
+	for _, pod := range toEvict {
+		if err := evictPod(timeoutCtx, pod, opts.GracePeriod); err != nil {
+			return fmt.Errorf("failed to evict pod %s/%s from node %s: %w", pod.Namespace, pod.Name, nodeName, err)
+		}
+	}
+
+	for _, pod := range toEvict {
+		if err := waitForPodDeletion(timeoutCtx, pod); err != nil {
+			return fmt.Errorf("failed waiting for pod %s/%s to leave node %s: %w", pod.Namespace, pod.Name, nodeName, err)
+		}
+	}
+
+	log.Info().
+		Str("node", nodeName).
+		Int("evicted_pods", len(toEvict)).
+		Msg("Node drained successfully")
+
+	return nil
+}
+
+// drainDecision reports whether a pod should be evicted, or a non-empty reason why it blocks the drain
+func drainDecision(pod corev1.Pod, opts DrainOptions) (bool, string) {
+	// Static pods are managed by the kubelet and cannot be evicted
+	if _, isMirror := pod.Annotations[mirrorPodAnnotation]; isMirror {
+		return false, ""
+	}
+
+	// Finished pods can always be removed
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return true, ""
+	}
+
+	controller := metav1.GetControllerOf(&pod)
+	if controller != nil && controller.Kind == "DaemonSet" {
+		if opts.IgnoreDaemonSets {
+			return false, ""
+		}
+		return false, "managed by a DaemonSet"
+	}
+
+	if controller == nil && !opts.Force {
+		return false, "not managed by a controller"
+	}
+
+	if !opts.DeleteEmptyDirData {
+		for _, volume := range pod.Spec.Volumes {
+			if volume.EmptyDir != nil {
+				return false, "uses emptyDir volume " + volume.Name
+			}
+		}
+	}
+
+	return true, ""
+}
+
+// evictPod evicts a single pod, retrying while a PodDisruptionBudget refuses the eviction
+func evictPod(ctx context.Context, pod corev1.Pod, gracePeriod time.Duration) error {
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	}
+	if gracePeriod > 0 {
+		seconds := int64(gracePeriod.Seconds())
+		eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &seconds}
+	}
+
+	for {
+		err := client.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, eviction)
+		switch {
+		case err == nil:
+			log.Debug().
+				Str("pod", pod.Name).
+				Str("namespace", pod.Namespace).
+				Msg("Pod evicted")
+			return nil
+		case apierrors.IsNotFound(err):
+			return nil
+		case apierrors.IsTooManyRequests(err):
+			log.Info().
+				Str("pod", pod.Name).
+				Str("namespace", pod.Namespace).
+				Msg("Eviction blocked by PodDisruptionBudget, retrying")
+		default:
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for PodDisruptionBudget to allow eviction: %w", ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// waitForPodDeletion waits until the given pod instance no longer exists
+func waitForPodDeletion(ctx context.Context, pod corev1.Pod) error {
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		current, err := client.clientset.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.UID != pod.UID) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout waiting for pod deletion: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForNodeReady waits until a single node reports the Ready condition
+func WaitForNodeReady(ctx context.Context, nodeName string, timeout time.Duration) error {
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	log.Info().
+		Str("node", nodeName).
+		Dur("timeout", timeout).
+		Msg("Waiting for node to become Ready")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		node, err := client.clientset.CoreV1().Nodes().Get(timeoutCtx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			log.Debug().Err(err).Str("node", nodeName).Msg("Failed to get node, retrying...")
+		} else if isNodeReady(node) {
+			log.Info().Str("node", nodeName).Msg("Node is Ready")
+			return nil
+		}
+
+		select {
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("timeout waiting for node %s to become Ready", nodeName)
+		case <-ticker.C:
+		}
+	}
+}
+
+// isNodeReady reports whether the node's Ready condition is true
+func isNodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package k8s
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/siderolabs/go-kubernetes/kubernetes/upgrade"
+	"github.com/siderolabs/talos/pkg/cluster/kubernetes"
+	"github.com/siderolabs/talos/pkg/machinery/client"
+	"github.com/siderolabs/talos/pkg/machinery/client/config"
+	talosconstants "github.com/siderolabs/talos/pkg/machinery/constants"
+)
+
+var (
+	// dryRunNodeLine matches upstream lines about a single node, e.g. ` > "10.0.0.2": starting update`
+	dryRunNodeLine = regexp.MustCompile(`^\s*[<>] "([^"]+)": (.*)$`)
+	// dryRunUpdateLine matches upstream lines about a changed component, e.g. ` > update kubelet: 1.32.1 -> 1.33.2`
+	dryRunUpdateLine = regexp.MustCompile(`^\s*> update (\S+): (\S+) -> (\S+)$`)
+	// dryRunSectionLine matches upstream lines that start upgrading a component, quoted for static pods,
+	// e.g. `updating "kube-apiserver" to version "1.33.2"`, and unquoted for `updating kubelet to version "1.33.2"`
+	dryRunSectionLine = regexp.MustCompile(`^updating "?([^"\s]+)"? to version "([^"]+)"$`)
+)
+
+// configImageFields maps each component to the machine configuration field the upgrade patches and the image it sets
+var configImageFields = map[string]struct {
+	field string
+	image string
+}{
+	"kubelet":                 {"machine.kubelet.image", talosconstants.KubeletImage},
+	"kube-apiserver":          {"cluster.apiServer.image", talosconstants.KubernetesAPIServerImage},
+	"kube-controller-manager": {"cluster.controllerManager.image", talosconstants.KubernetesControllerManagerImage},
+	"kube-scheduler":          {"cluster.scheduler.image", talosconstants.KubernetesSchedulerImage},
+	"kube-proxy":              {"cluster.proxy.image", talosconstants.KubeProxyImage},
+}
+
+// lineWriter ends every record written to it with a newline, upstream logs records without one
+type lineWriter struct {
+	w io.Writer
+}
+
+func (l lineWriter) Write(p []byte) (int, error) {
+	record := p
+	if len(record) == 0 || record[len(record)-1] != '\n' {
+		record = append(append([]byte{}, p...), '\n')
+	}
+	if _, err := l.w.Write(record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// DryRunResult holds the changes the upstream Kubernetes upgrade would make
+type DryRunResult struct {
+	FromVersion string
+	ToVersion   string
+	// Nodes maps node addresses to the proposed changes of their machine configuration
+	// and the upstream messages about them
+	Nodes map[string]*NodeDiff
+	// Manifests holds the proposed changes of the cluster bootstrap manifests
+	Manifests []string
+}
+
+// NodeDiff holds the proposed changes of a single node
+type NodeDiff struct {
+	Changes  []ComponentChange
+	Messages []string
+}
+
+// ComponentChange is a Kubernetes component whose image the upgrade changes in the machine
+// configuration of a node. From is empty when upstream does not report the current version.
+type ComponentChange struct {
+	Component string
+	From      string
+	To        string
+}
+
+// configLines returns the machine configuration field the change patches, before and after.
+// The current image is empty when its version is unknown.
+func (c ComponentChange) configLines() (string, string) {
+	target, known := configImageFields[c.Component]
+	if !known {
+		return c.Component + ": " + c.From, c.Component + ": " + c.To
+	}
+
+	var current string
+	if c.From != "" {
+		current = target.field + ": " + target.image + ":v" + strings.TrimPrefix(c.From, "v")
+	}
+	return current, target.field + ": " + target.image + ":v" + strings.TrimPrefix(c.To, "v")
+}
+
+// DryRunKubernetesUpgrade runs the upstream Kubernetes upgrade to targetVersion with DryRun set,
+// capturing the machine configuration and manifest changes it would make instead of applying them
+func DryRunKubernetesUpgrade(ctx context.Context, talosClient *client.Client, talosConfig *config.Config, nodeEndpoint, targetVersion string) (*DryRunResult, error) {
+	currentVersion, err := GetKubernetesVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current Kubernetes version: %w", err)
+	}
+
+	upgradePath, err := upgrade.NewPath(currentVersion, targetVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upgrade path from %s to %s: %w", currentVersion, targetVersion, err)
+	}
+
+	var output bytes.Buffer
+	upgradeOptions := newUpgradeOptions(upgradePath, nodeEndpoint, true)
+	upgradeOptions.LogOutput = lineWriter{w: &output}
+
+	log.Info().
+		Str("current_version", currentVersion).
+		Str("target_version", targetVersion).
+		Msg("Running Kubernetes upgrade in dry-run mode")
+
+	if err := kubernetes.Upgrade(ctx, newClusterProvider(talosClient, talosConfig), upgradeOptions); err != nil {
+		return nil, fmt.Errorf("dry run of Kubernetes upgrade from %s to %s failed: %w", currentVersion, targetVersion, err)
+	}
+
+	result := parseDryRunOutput(&output)
+	result.FromVersion = currentVersion
+	result.ToVersion = targetVersion
+
+	return result, nil
+}
+
+// parseDryRunOutput sorts the upstream dry-run log into the changes of each node and of the manifests
+func parseDryRunOutput(r io.Reader) *DryRunResult {
+	result := &DryRunResult{Nodes: make(map[string]*NodeDiff)}
+
+	var component, componentVersion, currentNode string
+	var inManifests bool
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " ")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch {
+		case dryRunSectionLine.MatchString(line):
+			match := dryRunSectionLine.FindStringSubmatch(line)
+			component, componentVersion = match[1], match[2]
+			currentNode, inManifests = "", false
+		case line == "updating manifests":
+			component, currentNode, inManifests = "", "", true
+		case line == "waiting for all manifests to be applied":
+			inManifests = false
+		case inManifests:
+			result.Manifests = append(result.Manifests, line)
+		case dryRunNodeLine.MatchString(line):
+			match := dryRunNodeLine.FindStringSubmatch(line)
+			currentNode = match[1]
+			diff := result.node(currentNode)
+			diff.Messages = append(diff.Messages, match[2])
+
+			// kube-proxy is patched without an update line, to the version of its section
+			if component == "kube-proxy" && match[2] == "starting update" {
+				diff.Changes = append(diff.Changes, ComponentChange{Component: component, To: componentVersion})
+			}
+		case currentNode != "" && dryRunUpdateLine.MatchString(line):
+			match := dryRunUpdateLine.FindStringSubmatch(line)
+			diff := result.node(currentNode)
+			diff.Changes = append(diff.Changes, ComponentChange{Component: match[1], From: match[2], To: match[3]})
+		case strings.TrimSpace(line) == "> skipped in dry-run":
+			// Every change is skipped in a dry run, repeating it adds nothing
+		case !strings.HasPrefix(line, " "):
+			// Other top level lines, e.g. the discovered nodes, end the lines of the last node
+			currentNode = ""
+		case currentNode != "":
+			result.node(currentNode).Messages = append(result.node(currentNode).Messages, strings.TrimSpace(line))
+		}
+	}
+
+	return result
+}
+
+// node returns the diff of a node, creating it on first use
+func (r *DryRunResult) node(address string) *NodeDiff {
+	diff, exists := r.Nodes[address]
+	if !exists {
+		diff = &NodeDiff{}
+		r.Nodes[address] = diff
+	}
+	return diff
+}
+
+// WriteDiff renders the proposed changes as a diff per node, followed by the manifest changes.
+// nodeNames maps node addresses to the names shown, IP addresses left in the output are redacted.
+func (r *DryRunResult) WriteDiff(w io.Writer, nodeNames map[string]string) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Kubernetes upgrade dry run: %s -> %s\n", r.FromVersion, r.ToVersion)
+
+	addresses := make([]string, 0, len(r.Nodes))
+	for address := range r.Nodes {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return displayName(addresses[i], nodeNames) < displayName(addresses[j], nodeNames)
+	})
+
+	for _, address := range addresses {
+		diff := r.Nodes[address]
+
+		name := displayName(address, nodeNames)
+		fmt.Fprintf(&b, "\n--- %s (current)\n+++ %s (proposed)\n", name, name)
+
+		if len(diff.Changes) == 0 {
+			b.WriteString("  (no machine configuration changes)\n")
+		}
+		for _, change := range diff.Changes {
+			current, proposed := change.configLines()
+			if current != "" {
+				fmt.Fprintf(&b, "-%s\n", current)
+			}
+			fmt.Fprintf(&b, "+%s\n", proposed)
+		}
+		for _, message := range diff.Messages {
+			fmt.Fprintf(&b, "# %s\n", message)
+		}
+	}
+
+	if len(r.Manifests) > 0 {
+		b.WriteString("\nManifests:\n")
+		for _, line := range r.Manifests {
+			fmt.Fprintln(&b, line)
+		}
+	}
+
+	_, err := newRedactingWriter(w).Write([]byte(b.String()))
+	return err
+}
+
+// displayName returns the name shown for a node address
+func displayName(address string, nodeNames map[string]string) string {
+	if name, exists := nodeNames[address]; exists {
+		return name
+	}
+	return address
+}
@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/siderolabs/talos/pkg/cluster/kubernetes"
+)
+
+// upstreamDryRunLog replays the records the upstream Kubernetes upgrade logs in a dry run from 1.32.3 to
+// 1.33.2, with the format strings of talos v1.12.6 and go-kubernetes, through the writer it is given
+func upstreamDryRunLog(options *kubernetes.UpgradeOptions) {
+	controlPlane := []string{"10.0.0.2"}
+	workers := []string{"10.0.0.3"}
+
+	options.Log("discovered controlplane nodes %q", controlPlane)
+	options.Log("discovered worker nodes %q", workers)
+	options.Log("checking for removed Kubernetes component flags")
+
+	for _, service := range []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler"} {
+		options.Log("updating %q to version %q", service, "1.33.2")
+		options.Log(" > %q: starting update", controlPlane[0])
+		options.Log(" > update %s: %s -> %s", service, "v1.32.3", "1.33.2")
+		options.Log(" > skipped in dry-run")
+	}
+
+	options.Log("updating kube-proxy to version %q", "1.33.2")
+	options.Log(" > %q: starting update", controlPlane[0])
+	options.Log(" > skipped in dry-run")
+
+	options.Log("updating kubelet to version %q", "1.33.2")
+	for _, node := range append(controlPlane, workers...) {
+		options.Log(" > %q: starting update", node)
+		options.Log(" > update %s: %s -> %s", "kubelet", "1.32.3", "1.33.2")
+		options.Log(" > skipped in dry-run")
+	}
+
+	options.Log("updating manifests")
+	options.Log(" > processing manifest %s", "v1.ConfigMap/kube-system/coredns")
+	options.Log("%s", "--- a/coredns\n+++ b/coredns\n-  image: coredns:1.11.4\n+  image: coredns:1.12.1")
+	options.Log(" < dry run, change skipped")
+}
+
+func TestParseDryRunOutput(t *testing.T) {
+	var output bytes.Buffer
+	options := &kubernetes.UpgradeOptions{LogOutput: lineWriter{w: &output}}
+	upstreamDryRunLog(options)
+
+	result := parseDryRunOutput(&output)
+
+	if len(result.Nodes) != 2 {
+		t.Fatalf("got diffs of %d nodes, want 2: %v", len(result.Nodes), result.Nodes)
+	}
+
+	controlPlane := result.Nodes["10.0.0.2"]
+	wantControlPlane := []ComponentChange{
+		{Component: "kube-apiserver", From: "v1.32.3", To: "1.33.2"},
+		{Component: "kube-controller-manager", From: "v1.32.3", To: "1.33.2"},
+		{Component: "kube-scheduler", From: "v1.32.3", To: "1.33.2"},
+		{Component: "kube-proxy", To: "1.33.2"},
+		{Component: "kubelet", From: "1.32.3", To: "1.33.2"},
+	}
+	if !slices.Equal(controlPlane.Changes, wantControlPlane) {
+		t.Errorf("control plane changes = %v, want %v", controlPlane.Changes, wantControlPlane)
+	}
+
+	worker := result.Nodes["10.0.0.3"]
+	wantWorker := []ComponentChange{{Component: "kubelet", From: "1.32.3", To: "1.33.2"}}
+	if !slices.Equal(worker.Changes, wantWorker) {
+		t.Errorf("worker changes = %v, want %v", worker.Changes, wantWorker)
+	}
+
+	wantManifests := []string{
+		" > processing manifest v1.ConfigMap/kube-system/coredns",
+		"--- a/coredns",
+		"+++ b/coredns",
+		"-  image: coredns:1.11.4",
+		"+  image: coredns:1.12.1",
+		" < dry run, change skipped",
+	}
+	if !slices.Equal(result.Manifests, wantManifests) {
+		t.Errorf("manifests = %q, want %q", result.Manifests, wantManifests)
+	}
+}
+
+func TestParseDryRunOutputUnterminatedRecords(t *testing.T) {
+	// Without lineWriter every record ends up on a single line, which must not be credited to any node
+	var output bytes.Buffer
+	options := &kubernetes.UpgradeOptions{LogOutput: &output}
+	upstreamDryRunLog(options)
+
+	result := parseDryRunOutput(&output)
+	for address, diff := range result.Nodes {
+		if len(diff.Changes) > 0 {
+			t.Errorf("node %s got changes %v from a single line log", address, diff.Changes)
+		}
+	}
+}
+
+func TestWriteDiff(t *testing.T) {
+	var output bytes.Buffer
+	options := &kubernetes.UpgradeOptions{LogOutput: lineWriter{w: &output}}
+	upstreamDryRunLog(options)
+
+	result := parseDryRunOutput(&output)
+	result.FromVersion = "v1.32.3"
+	result.ToVersion = "v1.33.2"
+
+	var diff strings.Builder
+	if err := result.WriteDiff(&diff, map[string]string{"10.0.0.2": "cp-01"}); err != nil {
+		t.Fatalf("WriteDiff: %v", err)
+	}
+	got := diff.String()
+
+	for _, want := range []string{
+		"Kubernetes upgrade dry run: v1.32.3 -> v1.33.2\n",
+		"--- cp-01 (current)\n+++ cp-01 (proposed)\n",
+		"-cluster.apiServer.image: registry.k8s.io/kube-apiserver:v1.32.3\n+cluster.apiServer.image: registry.k8s.io/kube-apiserver:v1.33.2\n",
+		"+cluster.proxy.image: registry.k8s.io/kube-proxy:v1.33.2\n",
+		"-machine.kubelet.image: ghcr.io/siderolabs/kubelet:v1.32.3\n+machine.kubelet.image: ghcr.io/siderolabs/kubelet:v1.33.2\n",
+		"# starting update\n",
+		"--- [redacted] (current)\n",
+		"Manifests:\n",
+		"+  image: coredns:1.12.1\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("diff does not contain %q:\n%s", want, got)
+		}
+	}
+
+	if strings.Contains(got, "-cluster.proxy.image") {
+		t.Errorf("diff shows a current kube-proxy image upstream does not report:\n%s", got)
+	}
+	if strings.Contains(got, "10.0.0.") {
+		t.Errorf("diff contains an unredacted address:\n%s", got)
+	}
+}
@@ -0,0 +1,252 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LeaseHeldError is returned when another holder has an active lease
+type LeaseHeldError struct {
+	Namespace string
+	Name      string
+	Holder    string
+	RenewTime time.Time
+	ExpiresAt time.Time
+}
+
+// Error implements the error interface
+func (e *LeaseHeldError) Error() string {
+	return fmt.Sprintf("lease %s/%s is held by %s, last renewed at %s and expiring at %s",
+		e.Namespace, e.Name, e.Holder, e.RenewTime.Format(time.RFC3339), e.ExpiresAt.Format(time.RFC3339))
+}
+
+// Lease is a coordination.k8s.io Lease held by this process and renewed in the background until released
+type Lease struct {
+	namespace string
+	name      string
+	holder    string
+	duration  time.Duration
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	lost     chan struct{}
+}
+
+// AcquireLease takes the lease namespace/name for holder, creating it if needed. An expired lease is
+// taken over, an active lease of another holder only when force is set. The lease is renewed every
+// third of duration until Release is called.
+func AcquireLease(ctx context.Context, namespace, name, holder string, duration time.Duration, force bool) (*Lease, error) {
+	client, err := GetSharedClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	leases := client.clientset.CoordinationV1().Leases(namespace)
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(duration.Seconds())
+
+	existing, err := leases.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		lease := &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		if _, err := leases.Create(ctx, lease, metav1.CreateOptions{}); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return nil, fmt.Errorf("lease %s/%s was taken by someone else at the same time", namespace, name)
+			}
+			return nil, fmt.Errorf("failed to create lease %s/%s: %w", namespace, name, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to get lease %s/%s: %w", namespace, name, err)
+	default:
+		if heldErr := leaseHeld(existing, holder); heldErr != nil {
+			if !force {
+				return nil, heldErr
+			}
+			log.Warn().
+				Str("lease", namespace+"/"+name).
+				Str("holder", heldErr.Holder).
+				Time("renew_time", heldErr.RenewTime).
+				Msg("Breaking lease held by another holder")
+		} else if existing.Spec.HolderIdentity != nil && *existing.Spec.HolderIdentity != "" && *existing.Spec.HolderIdentity != holder {
+			log.Warn().
+				Str("lease", namespace+"/"+name).
+				Str("holder", *existing.Spec.HolderIdentity).
+				Msg("Taking over expired lease")
+		}
+
+		transitions := int32(1)
+		if existing.Spec.LeaseTransitions != nil {
+			transitions = *existing.Spec.LeaseTransitions + 1
+		}
+		existing.Spec.HolderIdentity = &holder
+		existing.Spec.LeaseDurationSeconds = &durationSeconds
+		existing.Spec.AcquireTime = &now
+		existing.Spec.RenewTime = &now
+		existing.Spec.LeaseTransitions = &transitions
+
+		// The resource version makes the update fail if someone else took the lease since it was read
+		if _, err := leases.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			if apierrors.IsConflict(err) {
+				return nil, fmt.Errorf("lease %s/%s was taken by someone else at the same time", namespace, name)
+			}
+			return nil, fmt.Errorf("failed to take lease %s/%s: %w", namespace, name, err)
+		}
+	}
+
+	log.Info().
+		Str("lease", namespace+"/"+name).
+		Str("holder", holder).
+		Dur("duration", duration).
+		Msg("Lease acquired")
+
+	l := &Lease{
+		namespace: namespace,
+		name:      name,
+		holder:    holder,
+		duration:  duration,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		lost:      make(chan struct{}),
+	}
+	go l.renew()
+
+	return l, nil
+}
+
+// leaseHeld returns an error describing the holder if the lease is held by someone else and has not expired
+func leaseHeld(lease *coordinationv1.Lease, holder string) *LeaseHeldError {
+	spec := lease.Spec
+	if spec.HolderIdentity == nil || *spec.HolderIdentity == "" || *spec.HolderIdentity == holder {
+		return nil
+	}
+	if spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+		return nil
+	}
+
+	expiresAt := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+	if time.Now().After(expiresAt) {
+		return nil
+	}
+
+	return &LeaseHeldError{
+		Namespace: lease.Namespace,
+		Name:      lease.Name,
+		Holder:    *spec.HolderIdentity,
+		RenewTime: spec.RenewTime.Time,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// Lost is closed once the lease was found taken over by someone else, whoever holds it must stop
+func (l *Lease) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// renew keeps the lease alive until Release is called. Failed renewals are retried at the next
+// tick, a lease taken over by someone else is no longer renewed and reported through Lost.
+func (l *Lease) renew() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		lost, err := l.renewOnce()
+		if err != nil {
+			log.Warn().Err(err).Str("lease", l.namespace+"/"+l.name).Msg("Failed to renew lease")
+			continue
+		}
+		if lost {
+			log.Error().
+				Str("lease", l.namespace+"/"+l.name).
+				Msg("Lease was taken over by someone else, stopping")
+			close(l.lost)
+			return
+		}
+	}
+}
+
+// renewOnce moves the renew time of the lease forward, reporting whether it is held by someone else now
+func (l *Lease) renewOnce() (bool, error) {
+	client, err := GetSharedClient()
+	if err != nil {
+		return false, fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.duration/3)
+	defer cancel()
+
+	leases := client.clientset.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get lease: %w", err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		return true, nil
+	}
+
+	now := metav1.NewMicroTime(time.Now())
+	lease.Spec.RenewTime = &now
+	if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to update lease: %w", err)
+	}
+
+	return false, nil
+}
+
+// Release stops renewing the lease and deletes it, unless someone else has taken it over meanwhile
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+
+	client, err := GetSharedClient()
+	if err != nil {
+		return fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	leases := client.clientset.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get lease %s/%s: %w", l.namespace, l.name, err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		log.Warn().Str("lease", l.namespace+"/"+l.name).Msg("Lease is held by someone else now, leaving it alone")
+		return nil
+	}
+
+	resourceVersion := lease.ResourceVersion
+	err = leases.Delete(ctx, l.name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &resourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete lease %s/%s: %w", l.namespace, l.name, err)
+	}
+
+	log.Info().Str("lease", l.namespace+"/"+l.name).Msg("Lease released")
+	return nil
+}
@@ -7,6 +7,7 @@ import (
     "os"
     "regexp"
 
+    "github.com/bouquet2/water/version"
     "github.com/rs/zerolog/log"
     "github.com/siderolabs/go-kubernetes/kubernetes/upgrade"
     "github.com/siderolabs/talos/pkg/cluster"
@@ -51,40 +52,24 @@ func UpgradeKubernetesOnNode(ctx context.Context, talosClient *client.Client, ta
 		return fmt.Errorf("failed to get current Kubernetes version: %w", err)
 	}
 
+	// Kubernetes only supports moving one minor version at a time, larger jumps have to be split into steps
+	skipsMinors, err := version.SkipsMinorVersions(currentVersion, targetVersion)
+	if err != nil {
+		return fmt.Errorf("failed to check upgrade from %s to %s: %w", currentVersion, targetVersion, err)
+	}
+	if skipsMinors {
+		return fmt.Errorf("cannot upgrade Kubernetes from %s to %s in a single step, upgrade one minor version at a time", currentVersion, targetVersion)
+	}
+
 	// Create upgrade path from current version to target version
 	upgradePath, err := upgrade.NewPath(currentVersion, targetVersion)
 	if err != nil {
 		return fmt.Errorf("failed to create upgrade path from %s to %s: %w", currentVersion, targetVersion, err)
 	}
 
-	// Create a cluster provider that implements both ClientProvider and K8sProvider
-	// First create a ConfigClientProvider for the ClientProvider interface
-	clientProvider := &cluster.ConfigClientProvider{
-		DefaultClient: talosClient,
-		TalosConfig:   talosConfig,
-	}
-
-	// Then wrap it with KubernetesClient to get the K8sProvider interface
-	clusterProvider := &cluster.KubernetesClient{
-		ClientProvider: clientProvider,
-	}
+	clusterProvider := newClusterProvider(talosClient, talosConfig)
 
-    upgradeOptions := kubernetes.UpgradeOptions{
-        Path:                 upgradePath,
-        ControlPlaneEndpoint: nodeEndpoint,
-        UpgradeKubelet:       true,
-        PrePullImages:        true,
-        DryRun:               false,
-        EncoderOpt:           encoder.WithComments(encoder.CommentsAll),
-
-        // Explicitly set default image repositories required by Talos
-        // to avoid Validate() failing on empty image references.
-        KubeletImage:           talosconstants.KubeletImage,
-        APIServerImage:         talosconstants.KubernetesAPIServerImage,
-        ControllerManagerImage: talosconstants.KubernetesControllerManagerImage,
-        SchedulerImage:         talosconstants.KubernetesSchedulerImage,
-        ProxyImage:             talosconstants.KubeProxyImage,
-    }
+    upgradeOptions := newUpgradeOptions(upgradePath, nodeEndpoint, false)
 
     // Route Talos upgrade logs through a redactor to avoid printing raw IPs
     upgradeOptions.LogOutput = newRedactingWriter(os.Stdout)
@@ -105,9 +90,45 @@ func UpgradeKubernetesOnNode(ctx context.Context, talosClient *client.Client, ta
 
 	log.Info().
 		Str("node", nodeEndpoint).
-		Str("from_version", currentVersion).
-		Str("to_version", targetVersion).
+		Str("current_version", currentVersion).
+		Str("target_version", targetVersion).
 		Msg("Kubernetes upgrade completed successfully on node")
 
 	return nil
 }
+
+// newClusterProvider creates the cluster provider the upstream Kubernetes upgrade runs against
+func newClusterProvider(talosClient *client.Client, talosConfig *config.Config) *cluster.KubernetesClient {
+	// Create a cluster provider that implements both ClientProvider and K8sProvider
+	// First create a ConfigClientProvider for the ClientProvider interface
+	clientProvider := &cluster.ConfigClientProvider{
+		DefaultClient: talosClient,
+		TalosConfig:   talosConfig,
+	}
+
+	// Then wrap it with KubernetesClient to get the K8sProvider interface
+	return &cluster.KubernetesClient{
+		ClientProvider: clientProvider,
+	}
+}
+
+// newUpgradeOptions returns the options of the upstream Kubernetes upgrade along upgradePath.
+// A dry run reports the changes without applying them, and does not pre-pull images.
+func newUpgradeOptions(upgradePath *upgrade.Path, nodeEndpoint string, dryRun bool) kubernetes.UpgradeOptions {
+	return kubernetes.UpgradeOptions{
+		Path:                 upgradePath,
+		ControlPlaneEndpoint: nodeEndpoint,
+		UpgradeKubelet:       true,
+		PrePullImages:        !dryRun,
+		DryRun:               dryRun,
+		EncoderOpt:           encoder.WithComments(encoder.CommentsAll),
+
+		// Explicitly set default image repositories required by Talos
+		// to avoid Validate() failing on empty image references.
+		KubeletImage:           talosconstants.KubeletImage,
+		APIServerImage:         talosconstants.KubernetesAPIServerImage,
+		ControllerManagerImage: talosconstants.KubernetesControllerManagerImage,
+		SchedulerImage:         talosconstants.KubernetesSchedulerImage,
+		ProxyImage:             talosconstants.KubeProxyImage,
+	}
+}
@@ -177,8 +177,8 @@ func parseVersion(version string) ([3]int, error) {
 // IsVersionUpgradeNeeded checks if an upgrade is needed from current to target version
 func IsVersionUpgradeNeeded(currentVersion, targetVersion string) (bool, error) {
 	log.Debug().
-		Str("current", currentVersion).
-		Str("target", targetVersion).
+		Str("current_version", currentVersion).
+		Str("target_version", targetVersion).
 		Msg("Checking if Kubernetes version upgrade is needed")
 
 	if currentVersion == "" || targetVersion == "" {
@@ -194,8 +194,8 @@ func IsVersionUpgradeNeeded(currentVersion, targetVersion string) (bool, error)
 	upgradeNeeded := comparison < 0
 
 	log.Debug().
-		Str("current", currentVersion).
-		Str("target", targetVersion).
+		Str("current_version", currentVersion).
+		Str("target_version", targetVersion).
 		Bool("upgrade_needed", upgradeNeeded).
 		Msg("Version upgrade check completed")
 
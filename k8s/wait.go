@@ -0,0 +1,157 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// NodeHealth describes why a node is not yet healthy
+type NodeHealth struct {
+	Ready              bool
+	KubeletVersion     string
+	NotReadyStaticPods []string
+}
+
+// CheckNodeHealth reports whether a node is Ready, runs the expected kubelet version and
+// has all of its static pods running. An empty kubeletVersion skips the version check.
+func CheckNodeHealth(ctx context.Context, nodeName, kubeletVersion string) (bool, *NodeHealth, error) {
+	client, err := GetSharedClient()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	node, err := client.clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to get node %s: %w", nodeName, err)
+	}
+
+	health := &NodeHealth{
+		Ready:          isNodeReady(node),
+		KubeletVersion: node.Status.NodeInfo.KubeletVersion,
+	}
+
+	health.NotReadyStaticPods, err = notReadyStaticPods(ctx, nodeName)
+	if err != nil {
+		return false, health, err
+	}
+
+	versionMatches := kubeletVersion == "" ||
+		strings.TrimPrefix(health.KubeletVersion, "v") == strings.TrimPrefix(kubeletVersion, "v")
+
+	return health.Ready && versionMatches && len(health.NotReadyStaticPods) == 0, health, nil
+}
+
+// notReadyStaticPods returns the static pods on a node that are not running and ready
+func notReadyStaticPods(ctx context.Context, nodeName string) ([]string, error) {
+	client, err := GetSharedClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Kubernetes client: %w", err)
+	}
+
+	podList, err := client.clientset.CoreV1().Pods(metav1.NamespaceAll).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods on node %s: %w", nodeName, err)
+	}
+
+	var notReady []string
+	for _, pod := range podList.Items {
+		if _, isMirror := pod.Annotations[mirrorPodAnnotation]; !isMirror {
+			continue
+		}
+		if !isPodReady(&pod) {
+			notReady = append(notReady, pod.Namespace+"/"+pod.Name)
+		}
+	}
+
+	return notReady, nil
+}
+
+// isPodReady reports whether a pod is running and its Ready condition is true
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// WaitForNodeHealthy waits until a node is Ready, runs the expected kubelet version and has all of
+// its static pods running. An empty kubeletVersion skips the version check.
+func WaitForNodeHealthy(ctx context.Context, nodeName, kubeletVersion string, timeout time.Duration) error {
+	log.Info().
+		Str("node", nodeName).
+		Str("kubelet_version", kubeletVersion).
+		Dur("timeout", timeout).
+		Msg("Waiting for node to become healthy")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	var lastHealth *NodeHealth
+	for {
+		healthy, health, err := CheckNodeHealth(timeoutCtx, nodeName, kubeletVersion)
+		if err != nil {
+			log.Debug().Err(err).Str("node", nodeName).Msg("Failed to check node health, retrying...")
+		} else if healthy {
+			log.Info().Str("node", nodeName).Msg("Node is healthy")
+			return nil
+		} else {
+			lastHealth = health
+			log.Debug().
+				Str("node", nodeName).
+				Bool("ready", health.Ready).
+				Str("kubelet_version", health.KubeletVersion).
+				Strs("not_ready_static_pods", health.NotReadyStaticPods).
+				Msg("Node not healthy yet")
+		}
+
+		select {
+		case <-timeoutCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("stopped waiting for node %s to become healthy: %w", nodeName, err)
+			}
+			if lastHealth != nil {
+				return fmt.Errorf("timeout waiting for node %s to become healthy (ready=%t, kubelet=%s, not ready static pods=%v)",
+					nodeName, lastHealth.Ready, lastHealth.KubeletVersion, lastHealth.NotReadyStaticPods)
+			}
+			return fmt.Errorf("timeout waiting for node %s to become healthy", nodeName)
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForNodesHealthy waits for each of the given nodes to become healthy within a shared timeout
+func WaitForNodesHealthy(ctx context.Context, nodeNames []string, kubeletVersion string, timeout time.Duration) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, nodeName := range nodeNames {
+		deadline, _ := timeoutCtx.Deadline()
+		if err := WaitForNodeHealthy(timeoutCtx, nodeName, kubeletVersion, time.Until(deadline)); err != nil {
+			// The shared deadline ends the wait as a cancelled context, report it as the timeout it is
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return fmt.Errorf("timeout waiting for nodes to become healthy after %s, node %s is not healthy yet", timeout, nodeName)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,17 +1,30 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/daemon"
 	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/logging"
+	"github.com/bouquet2/water/metrics"
+	"github.com/bouquet2/water/notify"
+	"github.com/bouquet2/water/operator"
 	"github.com/bouquet2/water/talos"
 	"github.com/bouquet2/water/upgrade"
+	"github.com/bouquet2/water/version"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
 )
 
 var (
@@ -19,20 +32,100 @@ var (
 	appVersion = "devel"
 )
 
+// Exit codes of --check-only and --dry-run, so that scheduled CI jobs can act on the outcome.
+// An available upgrade only exits non-zero when --fail-if-outdated is set.
+const (
+	exitUpToDate         = 0
+	exitCheckError       = 1
+	exitUpgradeAvailable = 2
+	exitNotReleased      = 3
+)
+
+// options holds the command line options for a run
+type options struct {
+	command           string
+	configPath        string
+	talosConfigPath   string
+	kubeconfigPath    string
+	checkOnly         bool
+	dryRun            bool
+	failIfOutdated    bool
+	talosUpgradeOrder string
+	k8sUpgradeOrder   string
+	journalPath       string
+	resume            bool
+	breakLock         bool
+	output            string
+	planFile          string
+	interval          time.Duration
+	listenAddress     string
+	autoUpgrade       bool
+	metricsAddress    string
+	logFormat         string
+	reportPath        string
+	reportFormat      string
+}
+
+// logOptions holds the command line options that configure logging
+type logOptions struct {
+	verbose       bool
+	quiet         bool
+	format        string
+	file          string
+	fileMaxSize   int
+	fileMaxBackup int
+}
+
 func main() {
+	// The first argument may name a subcommand, its flags follow it
+	command := "upgrade"
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "plan" || args[0] == "serve" || args[0] == "operator") {
+		command = args[0]
+		args = args[1:]
+	}
+
 	// Parse command line flags
 	var (
 		configPath        = flag.String("config", "", "Path to configuration file (default: search for water.yaml)")
 		talosConfigPath   = flag.String("talosconfig", "", "Path to Talos client configuration file (default: ~/.talos/config)")
 		kubeconfigPath    = flag.String("kubeconfig", "", "Path to kubeconfig file (default: ~/.kube/config or KUBECONFIG env var)")
 		checkOnly         = flag.Bool("check-only", false, "Only check versions without performing upgrades")
+		dryRun            = flag.Bool("dry-run", false, "Check versions and show the changes the next Kubernetes upgrade step would make per node, without applying them")
+		failIfOutdated    = flag.Bool("fail-if-outdated", false, "Exit --check-only and --dry-run with code 2 when an upgrade is available")
 		verbose           = flag.Bool("verbose", false, "Enable verbose logging")
 		quiet             = flag.Bool("quiet", false, "Enable quiet mode (errors only)")
+		logFormat         = flag.String("log-format", "console", "Log format: 'console' or 'json'")
+		logFile           = flag.String("log-file", "", "Also write logs to this file, rotating it once it reaches --log-max-size")
+		logMaxSize        = flag.Int("log-max-size", 100, "Size in megabytes at which the log file is rotated")
+		logMaxBackups     = flag.Int("log-max-backups", 5, "Number of rotated log files to keep")
 		version           = flag.Bool("version", false, "Show version information")
 		talosUpgradeOrder = flag.String("talos-upgrade-order", "", "Override Talos upgrade order: 'control-plane-first' or 'workers-first'")
 		k8sUpgradeOrder   = flag.String("k8s-upgrade-order", "", "Override Kubernetes upgrade order: 'control-plane-first' or 'workers-first'")
+		journalPath       = flag.String("journal", "", "Path to the upgrade journal file (default: journal.path from config or ~/.water/journal.json), for the operator command the directory of the journals of each ClusterUpgrade (default: ~/.water/clusterupgrades)")
+		resume            = flag.Bool("resume", false, "Resume an interrupted upgrade from the journal")
+		breakLock         = flag.Bool("break-lock", false, "Take over the upgrade lock even if another holder still renews it, for locks left behind by a hung run")
+		output            = flag.String("output", "text", "Output format of the plan command and the --check-only summary: 'text', 'json' or 'yaml'")
+		planFile          = flag.String("plan-file", "", "Run the upgrade exactly as described by a plan file written by the plan command")
+		interval          = flag.Duration("interval", 10*time.Minute, "Time between reconciliations of the serve and operator commands")
+		listenAddress     = flag.String("listen", ":8080", "Address the serve command exposes its status on, empty to disable")
+		autoUpgrade       = flag.Bool("auto-upgrade", true, "Let the serve command upgrade the cluster when it drifts, instead of only reporting it")
+		metricsAddress    = flag.String("metrics-listen", "", "Address to expose Prometheus metrics on, e.g. ':9090' (the serve command also exposes them on --listen)")
+		reportPath        = flag.String("report", "", "Write a report of the upgrade run, with a record for every node, to this file")
+		reportFormat      = flag.String("report-format", "", "Format of the --report file: 'json', 'junit' or 'markdown' (default: from its extension, .xml for junit, .md for markdown, json otherwise)")
 	)
-	flag.Parse()
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [plan|serve|operator] [flags]\n", appName)
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), `
+Exit codes of --check-only and --dry-run:
+  %d  the cluster runs the target versions, or an upgrade is available and --fail-if-outdated is not set
+  %d  the check itself failed
+  %d  an upgrade is available and --fail-if-outdated is set
+  %d  a target version is not released yet
+`, exitUpToDate, exitCheckError, exitUpgradeAvailable, exitNotReleased)
+	}
+	_ = flag.CommandLine.Parse(args)
 
 	// Show version and exit
 	if *version {
@@ -40,72 +133,184 @@ func main() {
 		return
 	}
 
-	// Set up logging
-	setupLogging(*verbose, *quiet)
+	// Set up logging, keeping stdout free for the plan or check summary when printing one
+	logOutput := os.Stdout
+	if command == "plan" || (*checkOnly && *output != "text") {
+		logOutput = os.Stderr
+	}
+	rotatingLogFile, err := setupLogging(logOptions{
+		verbose:       *verbose,
+		quiet:         *quiet,
+		format:        *logFormat,
+		file:          *logFile,
+		fileMaxSize:   *logMaxSize,
+		fileMaxBackup: *logMaxBackups,
+	}, logOutput)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", appName, err)
+		os.Exit(1)
+	}
 
 	// Run the main application logic and exit with the returned code
-	os.Exit(run(*configPath, *talosConfigPath, *kubeconfigPath, *checkOnly, *talosUpgradeOrder, *k8sUpgradeOrder))
+	code := run(options{
+		command:           command,
+		configPath:        *configPath,
+		talosConfigPath:   *talosConfigPath,
+		kubeconfigPath:    *kubeconfigPath,
+		checkOnly:         *checkOnly,
+		dryRun:            *dryRun,
+		failIfOutdated:    *failIfOutdated,
+		talosUpgradeOrder: *talosUpgradeOrder,
+		k8sUpgradeOrder:   *k8sUpgradeOrder,
+		journalPath:       *journalPath,
+		resume:            *resume,
+		breakLock:         *breakLock,
+		output:            *output,
+		planFile:          *planFile,
+		interval:          *interval,
+		listenAddress:     *listenAddress,
+		autoUpgrade:       *autoUpgrade,
+		metricsAddress:    *metricsAddress,
+		logFormat:         *logFormat,
+		reportPath:        *reportPath,
+		reportFormat:      *reportFormat,
+	})
+
+	if rotatingLogFile != nil {
+		_ = rotatingLogFile.Close()
+	}
+	os.Exit(code)
 }
 
-func run(configPath, talosConfigPath, kubeconfigPath string, checkOnly bool, talosUpgradeOrder, k8sUpgradeOrder string) int {
-	// Display ASCII logo
-	fmt.Println(`                 __
+func run(opts options) int {
+	// Display ASCII logo on stderr, JSON logs are meant for log pipelines and get none
+	if opts.logFormat != "json" {
+		fmt.Fprintln(os.Stderr, `                 __
 __  _  _______ _/  |_  ___________
 \ \/ \/ /\__  \\   __\/ __ \_  __ \
  \     /  / __ \|  | \  ___/|  | \/
   \/\_/  (____  /__|  \___  >__|
               \/          \/       `)
+	}
 
 	log.Info().
 		Str("app", appName).
 		Str("version", appVersion).
 		Msg("Starting water - Talos Linux and Kubernetes upgrade tool")
 
-	// Set default Talos config path if not provided
-	if talosConfigPath == "" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to get user home directory")
-			return 1
-		}
-		talosConfigPath = filepath.Join(homeDir, ".talos", "config")
+	if (opts.checkOnly || opts.dryRun) && opts.resume {
+		log.Error().Msg("--resume cannot be combined with --check-only or --dry-run")
+		return 1
 	}
 
-	// Load configuration
-	cfg, err := config.LoadConfig(configPath)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to load configuration")
+	if opts.command == "plan" && (opts.checkOnly || opts.dryRun || opts.resume || opts.planFile != "") {
+		log.Error().Msg("The plan command cannot be combined with --check-only, --dry-run, --resume or --plan-file")
 		return 1
 	}
 
-	// Apply command-line overrides for upgrade orders
-	if talosUpgradeOrder != "" {
-		if talosUpgradeOrder != "control-plane-first" && talosUpgradeOrder != "workers-first" {
-			log.Error().Str("order", talosUpgradeOrder).Msg("Invalid talos-upgrade-order: must be 'control-plane-first' or 'workers-first'")
-			return 1
-		}
-		cfg.Talos.UpgradeOrder = config.UpgradeOrder(talosUpgradeOrder)
-		log.Info().Str("order", talosUpgradeOrder).Msg("Overriding Talos upgrade order from command line")
+	if (opts.checkOnly || opts.dryRun) && opts.planFile != "" {
+		log.Error().Msg("--plan-file cannot be combined with --check-only or --dry-run")
+		return 1
 	}
 
-	if k8sUpgradeOrder != "" {
-		if k8sUpgradeOrder != "control-plane-first" && k8sUpgradeOrder != "workers-first" {
-			log.Error().Str("order", k8sUpgradeOrder).Msg("Invalid k8s-upgrade-order: must be 'control-plane-first' or 'workers-first'")
-			return 1
-		}
-		cfg.K8s.UpgradeOrder = config.UpgradeOrder(k8sUpgradeOrder)
-		log.Info().Str("order", k8sUpgradeOrder).Msg("Overriding Kubernetes upgrade order from command line")
+	if opts.command == "serve" && (opts.checkOnly || opts.dryRun || opts.resume || opts.planFile != "") {
+		log.Error().Msg("The serve command cannot be combined with --check-only, --dry-run, --resume or --plan-file")
+		return 1
+	}
+
+	if opts.command == "operator" && (opts.checkOnly || opts.dryRun || opts.resume || opts.planFile != "" || opts.configPath != "") {
+		log.Error().Msg("The operator command reads its configuration from ClusterUpgrade resources and cannot be combined with --config, --check-only, --dry-run, --resume or --plan-file")
+		return 1
+	}
+
+	if opts.reportPath != "" && (opts.command != "upgrade" || opts.checkOnly || opts.dryRun) {
+		log.Error().Msg("--report only applies to upgrades and cannot be combined with the plan, serve or operator commands, --check-only or --dry-run")
+		return 1
+	}
+
+	reportFormat := opts.reportFormat
+	if reportFormat == "" {
+		reportFormat = reportFormatFromPath(opts.reportPath)
+	}
+	if reportFormat != "json" && reportFormat != "junit" && reportFormat != "markdown" {
+		log.Error().Str("report_format", reportFormat).Msg("Invalid report format: must be 'json', 'junit' or 'markdown'")
+		return 1
+	}
+
+	if (opts.command == "serve" || opts.command == "operator") && opts.interval <= 0 {
+		log.Error().Dur("interval", opts.interval).Msg("Invalid interval: must be positive")
+		return 1
+	}
+
+	if opts.output != "text" && opts.output != "json" && opts.output != "yaml" {
+		log.Error().Str("output", opts.output).Msg("Invalid output: must be 'text', 'json' or 'yaml'")
+		return 1
+	}
+
+	// The dry run prints its diff on stdout, which leaves no room for a check summary
+	if opts.output != "text" && opts.command != "plan" && (!opts.checkOnly || opts.dryRun) {
+		log.Error().Msg("--output only applies to the plan command and to --check-only without --dry-run")
+		return 1
+	}
+
+	if opts.breakLock && (opts.command != "upgrade" || opts.checkOnly || opts.dryRun) {
+		log.Error().Msg("--break-lock only applies to upgrades and cannot be combined with the plan, serve or operator commands, --check-only or --dry-run")
+		return 1
+	}
+
+	if opts.failIfOutdated && !opts.checkOnly && !opts.dryRun {
+		log.Error().Msg("--fail-if-outdated requires --check-only or --dry-run")
+		return 1
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get user home directory")
+		return 1
+	}
+
+	// Set default Talos config path if not provided
+	talosConfigPath := opts.talosConfigPath
+	if talosConfigPath == "" {
+		talosConfigPath = filepath.Join(homeDir, ".talos", "config")
 	}
 
 	// Initialize Kubernetes client with kubeconfig path if provided
-	if kubeconfigPath != "" {
-		log.Info().Str("kubeconfig", kubeconfigPath).Msg("Initializing Kubernetes client with custom kubeconfig")
-		if err := k8s.InitializeClient(kubeconfigPath); err != nil {
+	if opts.kubeconfigPath != "" {
+		log.Info().Str("kubeconfig", opts.kubeconfigPath).Msg("Initializing Kubernetes client with custom kubeconfig")
+		if err := k8s.InitializeClient(opts.kubeconfigPath); err != nil {
 			log.Error().Err(err).Msg("Failed to initialize Kubernetes client")
 			return 1
 		}
 	}
 
+	// Expose metrics for as long as water runs; the daemon also serves them on its status listener
+	var collector *metrics.Collector
+	if opts.metricsAddress != "" || opts.command == "serve" {
+		collector = metrics.New()
+	}
+	if opts.metricsAddress != "" {
+		stopMetrics := collector.Start(opts.metricsAddress)
+		defer stopMetrics()
+	}
+
+	// The operator reads a configuration from every ClusterUpgrade resource instead of a file
+	if opts.command == "operator" {
+		return operate(opts, talosConfigPath, homeDir, collector)
+	}
+
+	// Load configuration
+	cfg, err := loadConfig(opts)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load configuration")
+		return 1
+	}
+
+	// The daemon re-reads the configuration and creates its clients on every reconciliation
+	if opts.command == "serve" {
+		return serve(opts, talosConfigPath, homeDir, collector)
+	}
+
 	// Create Talos client
 	talosClient, err := talos.NewClient(talosConfigPath)
 	if err != nil {
@@ -120,67 +325,378 @@ __  _  _______ _/  |_  ___________
 
 	// Create upgrade manager
 	upgradeManager := upgrade.NewManager(talosClient, cfg)
+	if collector != nil {
+		upgradeManager.AddEventHandler(collector.HandleEvent)
+	}
+
+	// Planning and checking change nothing, so a signal simply cancels them
+	ctx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stopSignals()
+
+	// Print the plan without touching the cluster
+	if opts.command == "plan" {
+		plan, err := upgradeManager.BuildPlan(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to build upgrade plan")
+			return 1
+		}
+
+		if err := plan.Write(os.Stdout, opts.output); err != nil {
+			log.Error().Err(err).Msg("Failed to write upgrade plan")
+			return 1
+		}
+		return 0
+	}
 
 	// Perform the operation
-	if checkOnly {
+	if opts.checkOnly || opts.dryRun {
 		log.Info().Msg("Running in check-only mode")
-		if err := upgradeManager.CheckOnly(); err != nil {
+		check, err := upgradeManager.CheckOnly(ctx)
+		if err != nil {
 			log.Error().Err(err).Msg("Version check failed")
-			return 1
+			return exitCheckError
 		}
-	} else {
-		log.Info().Msg("Running upgrade process")
-		result, err := upgradeManager.PerformUpgrade()
-		if err != nil {
-			log.Error().Err(err).Msg("Upgrade process failed")
-			return 1
+
+		if opts.output != "text" {
+			if err := check.Write(os.Stdout, opts.output); err != nil {
+				log.Error().Err(err).Msg("Failed to write check summary")
+				return exitCheckError
+			}
 		}
 
-		// Handle upgrade results
-		if result.HasErrors() {
-			log.Error().Msg("Upgrade completed with errors")
-			for _, err := range result.Errors {
-				log.Error().Err(err).Msg("Upgrade error")
+		// Let the upstream Kubernetes upgrade report what it would change, without changing it
+		if opts.dryRun {
+			if err := upgradeManager.KubernetesDryRun(ctx, os.Stdout); err != nil {
+				log.Error().Err(err).Msg("Kubernetes dry run failed")
+				return exitCheckError
 			}
+		}
+
+		return checkExitCode(check, opts.failIfOutdated)
+	}
+
+	// A plan file replaces planning, the upgrade follows it step by step
+	var plan *upgrade.Plan
+	if opts.planFile != "" {
+		plan, err = upgrade.LoadPlan(opts.planFile)
+		if err != nil {
+			log.Error().Err(err).Str("plan_file", opts.planFile).Msg("Failed to load upgrade plan")
 			return 1
 		}
+	}
+
+	journalPath := resolveJournalPath(opts, cfg, homeDir)
+	journal, err := upgrade.OpenJournal(journalPath, opts.resume, cfg)
+	if err != nil {
+		log.Error().Err(err).Str("journal", journalPath).Msg("Failed to open upgrade journal")
+		return 1
+	}
+	upgradeManager.SetJournal(journal)
+	upgradeManager.SetBreakLock(opts.breakLock)
+
+	// Report progress to the configured notification backends
+	notifier := notify.New(cfg.Notifications)
+	defer notifier.Close()
+	upgradeManager.AddEventHandler(notifier.HandleEvent)
 
-		if result.TalosUpgraded || result.K8sUpgraded {
-			log.Info().
-				Bool("talos_upgraded", result.TalosUpgraded).
-				Bool("k8s_upgraded", result.K8sUpgraded).
-				Msg("Upgrade process completed successfully")
+	// The first signal lets the nodes in progress finish and stops the upgrade, the second one aborts it
+	stopSignals()
+	upgradeCtx, stopUpgradeSignals := handleSignals(upgradeManager.Stop)
+	defer stopUpgradeSignals()
+
+	var result *upgrade.UpgradeResult
+	if plan != nil {
+		log.Info().Str("plan_file", opts.planFile).Msg("Running upgrade process from plan file")
+		result, err = upgradeManager.ExecutePlan(upgradeCtx, plan)
+	} else {
+		log.Info().Msg("Running upgrade process")
+		result, err = upgradeManager.PerformUpgrade(upgradeCtx)
+	}
+
+	// The report is written for failed runs too, those are the ones worth reading
+	if opts.reportPath != "" {
+		if reportErr := writeReport(result, opts.reportPath, reportFormat); reportErr != nil {
+			log.Error().Err(reportErr).Str("report", opts.reportPath).Msg("Failed to write upgrade report")
 		} else {
-			log.Info().Msg("No upgrades were needed - cluster is already up to date")
+			log.Info().Str("report", opts.reportPath).Str("format", reportFormat).Msg("Upgrade report written")
+		}
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Upgrade process failed")
+		return 1
+	}
+
+	// Excluded nodes were deliberately left alone, call them out so they are not forgotten
+	for _, skipped := range result.SkippedNodes {
+		log.Warn().
+			Str("node", skipped.Name).
+			Str("reason", skipped.Reason).
+			Msg("Node was excluded from the upgrade")
+	}
+
+	// Handle upgrade results
+	if result.HasErrors() {
+		log.Error().Msg("Upgrade completed with errors")
+		for _, err := range result.Errors {
+			log.Error().Err(err).Msg("Upgrade error")
 		}
+		return 1
+	}
+
+	if result.TalosUpgraded || result.K8sUpgraded {
+		log.Info().
+			Bool("talos_upgraded", result.TalosUpgraded).
+			Bool("k8s_upgraded", result.K8sUpgraded).
+			Msg("Upgrade process completed successfully")
+	} else {
+		log.Info().Msg("No upgrades were needed - cluster is already up to date")
 	}
 
 	log.Info().Msg("Watered all the plants")
 	return 0
 }
 
-// setupLogging configures zerolog based on the provided flags
-func setupLogging(verbose, quiet bool) {
-	// Set up console writer with colors
-	output := zerolog.ConsoleWriter{
-		Out: os.Stdout,
+// loadConfig loads the configuration, applies the command line overrides and checks that the
+// configured Talos and Kubernetes versions are compatible
+func loadConfig(opts options) (*config.Config, error) {
+	cfg, err := config.LoadConfig(opts.configPath)
+	if err != nil {
+		return nil, err
 	}
 
-	log.Logger = zerolog.New(output).With().Timestamp().Logger()
+	// Apply command-line overrides for upgrade orders
+	if opts.talosUpgradeOrder != "" {
+		if opts.talosUpgradeOrder != "control-plane-first" && opts.talosUpgradeOrder != "workers-first" {
+			return nil, fmt.Errorf("invalid talos-upgrade-order '%s': must be 'control-plane-first' or 'workers-first'", opts.talosUpgradeOrder)
+		}
+		cfg.Talos.UpgradeOrder = config.UpgradeOrder(opts.talosUpgradeOrder)
+		log.Info().Str("order", opts.talosUpgradeOrder).Msg("Overriding Talos upgrade order from command line")
+	}
+
+	if opts.k8sUpgradeOrder != "" {
+		if opts.k8sUpgradeOrder != "control-plane-first" && opts.k8sUpgradeOrder != "workers-first" {
+			return nil, fmt.Errorf("invalid k8s-upgrade-order '%s': must be 'control-plane-first' or 'workers-first'", opts.k8sUpgradeOrder)
+		}
+		cfg.K8s.UpgradeOrder = config.UpgradeOrder(opts.k8sUpgradeOrder)
+		log.Info().Str("order", opts.k8sUpgradeOrder).Msg("Overriding Kubernetes upgrade order from command line")
+	}
+
+	// Refuse to start with a Talos and Kubernetes combination that is not supported
+	compatibility, err := version.LoadCompatibilityMatrix(cfg.Compatibility.OverrideFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compatibility matrix: %w", err)
+	}
+	if err := compatibility.Check(cfg.Talos.Version, cfg.K8s.Version); err != nil {
+		return nil, fmt.Errorf("configured Talos and Kubernetes versions are not compatible: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// checkExitCode maps the outcome of a successful check to the exit code. A target that is not released
+// yet is a configuration problem and always exits non-zero, an available upgrade only with failIfOutdated.
+func checkExitCode(check *upgrade.CheckResult, failIfOutdated bool) int {
+	switch check.Status {
+	case upgrade.CheckUpgradeAvailable:
+		if failIfOutdated {
+			return exitUpgradeAvailable
+		}
+		return exitUpToDate
+	case upgrade.CheckNotReleased:
+		return exitNotReleased
+	default:
+		return exitUpToDate
+	}
+}
+
+// reportFormatFromPath picks the report format matching the extension of the report file
+func reportFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xml":
+		return "junit"
+	case ".md", ".markdown":
+		return "markdown"
+	default:
+		return "json"
+	}
+}
+
+// writeReport writes the report of an upgrade run to path
+func writeReport(result *upgrade.UpgradeResult, path, format string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+
+	if err := result.WriteReport(file, format); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// resolveJournalPath returns the journal location: flag, then config, then default
+func resolveJournalPath(opts options, cfg *config.Config, homeDir string) string {
+	if opts.journalPath != "" {
+		return opts.journalPath
+	}
+	if cfg.Journal.Path != "" {
+		return cfg.Journal.Path
+	}
+	return filepath.Join(homeDir, ".water", "journal.json")
+}
+
+// handleSignals returns the context of an upgrade. The first SIGINT or SIGTERM calls stop, which lets the
+// nodes in progress finish before the upgrade stops, the second one cancels the context to abort at once.
+// The returned function stops handling the signals.
+func handleSignals(stop func()) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warn().Str("signal", sig.String()).Msg("Received signal, send it again to abort the upgrade")
+			stop()
+		case <-done:
+			return
+		}
+
+		select {
+		case sig := <-signals:
+			log.Warn().Str("signal", sig.String()).Msg("Aborting upgrade")
+			cancel()
+		case <-done:
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(signals)
+		close(done)
+		cancel()
+	}
+}
+
+// serve runs the daemon until SIGTERM or SIGINT
+func serve(opts options, talosConfigPath, homeDir string, collector *metrics.Collector) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	d := daemon.New(daemon.Options{
+		LoadConfig: func() (*config.Config, error) {
+			return loadConfig(opts)
+		},
+		JournalPath: func(cfg *config.Config) string {
+			return resolveJournalPath(opts, cfg, homeDir)
+		},
+		TalosConfigPath: talosConfigPath,
+		Interval:        opts.interval,
+		ListenAddress:   opts.listenAddress,
+		AutoUpgrade:     opts.autoUpgrade,
+		Metrics:         collector,
+	})
+
+	if err := d.Run(ctx); err != nil {
+		log.Error().Err(err).Msg("Daemon stopped")
+		return 1
+	}
+
+	log.Info().Msg("Daemon stopped")
+	return 0
+}
+
+// operate runs the ClusterUpgrade operator until SIGTERM or SIGINT
+func operate(opts options, talosConfigPath, homeDir string, collector *metrics.Collector) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	// Each ClusterUpgrade gets its own journal, named after it
+	journalDir := filepath.Join(homeDir, ".water", "clusterupgrades")
+	if opts.journalPath != "" {
+		journalDir = opts.journalPath
+	}
+
+	o := operator.New(operator.Options{
+		TalosConfigPath: talosConfigPath,
+		JournalDir:      journalDir,
+		Interval:        opts.interval,
+		Metrics:         collector,
+	})
+
+	if err := o.Run(ctx); err != nil {
+		log.Error().Err(err).Msg("Operator stopped")
+		return 1
+	}
+
+	log.Info().Msg("Operator stopped")
+	return 0
+}
+
+// setupLogging configures zerolog based on the provided flags. It returns the log file, if any,
+// which must be closed before exiting.
+func setupLogging(opts logOptions, out *os.File) (*logging.RotatingFile, error) {
+	var writers []io.Writer
+	switch opts.format {
+	case "console":
+		writers = append(writers, zerolog.ConsoleWriter{
+			Out:     out,
+			NoColor: !colorEnabled(out),
+		})
+	case "json":
+		writers = append(writers, out)
+	default:
+		return nil, fmt.Errorf("invalid log format '%s': must be 'console' or 'json'", opts.format)
+	}
+
+	// The log file gets the same format, but never colors
+	var logFile *logging.RotatingFile
+	if opts.file != "" {
+		var err error
+		logFile, err = logging.OpenRotatingFile(opts.file, opts.fileMaxSize, opts.fileMaxBackup)
+		if err != nil {
+			return nil, err
+		}
+
+		if opts.format == "json" {
+			writers = append(writers, logFile)
+		} else {
+			writers = append(writers, zerolog.ConsoleWriter{Out: logFile, NoColor: true})
+		}
+	}
+
+	log.Logger = zerolog.New(zerolog.MultiLevelWriter(writers...)).With().Timestamp().Logger()
 
 	// Set log level based on flags
 	switch {
-	case quiet:
+	case opts.quiet:
 		zerolog.SetGlobalLevel(zerolog.ErrorLevel)
-	case verbose:
+	case opts.verbose:
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	default:
 		zerolog.SetGlobalLevel(zerolog.InfoLevel)
 	}
 
 	log.Debug().
-		Bool("verbose", verbose).
-		Bool("quiet", quiet).
+		Bool("verbose", opts.verbose).
+		Bool("quiet", opts.quiet).
+		Str("format", opts.format).
+		Str("file", opts.file).
 		Str("level", zerolog.GlobalLevel().String()).
 		Msg("Logging configured")
+
+	return logFile, nil
+}
+
+// colorEnabled reports whether console logs written to f should be colored: only on a terminal,
+// and not when NO_COLOR is set
+func colorEnabled(f *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return term.IsTerminal(int(f.Fd()))
 }
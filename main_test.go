@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bouquet2/water/upgrade"
+)
+
+func TestCheckExitCode(t *testing.T) {
+	tests := []struct {
+		status         upgrade.CheckStatus
+		failIfOutdated bool
+		want           int
+	}{
+		{upgrade.CheckUpToDate, false, exitUpToDate},
+		{upgrade.CheckUpgradeAvailable, false, exitUpToDate},
+		{upgrade.CheckNotReleased, false, exitNotReleased},
+		{upgrade.CheckUpToDate, true, exitUpToDate},
+		{upgrade.CheckUpgradeAvailable, true, exitUpgradeAvailable},
+		{upgrade.CheckNotReleased, true, exitNotReleased},
+	}
+
+	for _, tt := range tests {
+		got := checkExitCode(&upgrade.CheckResult{Status: tt.status}, tt.failIfOutdated)
+		if got != tt.want {
+			t.Errorf("checkExitCode(%s, failIfOutdated=%t) = %d, want %d", tt.status, tt.failIfOutdated, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouquet2/water/upgrade"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+)
+
+// shutdownTimeout bounds how long the metrics server may take to shut down
+const shutdownTimeout = 5 * time.Second
+
+// phaseIdle is reported as the upgrade phase while no upgrade runs
+const phaseIdle upgrade.Phase = "idle"
+
+// reportedPhases are the upgrade phases exposed by water_upgrade_phase, in output order
+var reportedPhases = []upgrade.Phase{phaseIdle, upgrade.PhasePrerequisites, upgrade.PhaseTalos, upgrade.PhaseKubernetes}
+
+// durationBuckets are the upper bounds, in seconds, of the node upgrade duration histogram
+var durationBuckets = []float64{60, 120, 300, 600, 900, 1200, 1800, 3600}
+
+// nodeKey identifies a node within a phase and target version
+type nodeKey struct {
+	phase         upgrade.Phase
+	targetVersion string
+	node          string
+}
+
+// histogram is a cumulative Prometheus histogram
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// observe adds a value to the histogram
+func (h *histogram) observe(value float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Collector records upgrade events and serves them as Prometheus metrics
+type Collector struct {
+	mu          sync.Mutex
+	nodes       map[string]upgrade.NodeVersions
+	phase       upgrade.Phase
+	nodeStates  map[nodeKey]upgrade.NodeState
+	nodeStarts  map[nodeKey]time.Time
+	durations   map[upgrade.Phase]*histogram
+	failures    map[upgrade.Phase]uint64
+	runs        map[string]uint64
+	lastSuccess time.Time
+}
+
+// New creates an empty collector
+func New() *Collector {
+	return &Collector{
+		nodes:      make(map[string]upgrade.NodeVersions),
+		phase:      phaseIdle,
+		nodeStates: make(map[nodeKey]upgrade.NodeState),
+		nodeStarts: make(map[nodeKey]time.Time),
+		durations:  make(map[upgrade.Phase]*histogram),
+		failures:   make(map[upgrade.Phase]uint64),
+		runs:       make(map[string]uint64),
+	}
+}
+
+// HandleEvent records an upgrade event, it is meant to be registered with upgrade.Manager.AddEventHandler
+func (c *Collector) HandleEvent(event upgrade.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch event.Type {
+	case upgrade.EventStarted:
+		c.phase = upgrade.PhasePrerequisites
+		// Only the states of the current run are of interest
+		c.nodeStates = make(map[nodeKey]upgrade.NodeState)
+		c.nodeStarts = make(map[nodeKey]time.Time)
+	case upgrade.EventPhaseStarted:
+		c.phase = event.Phase
+	case upgrade.EventNode:
+		key := nodeKey{phase: event.Phase, targetVersion: event.TargetVersion, node: event.Node}
+		c.nodeStates[key] = event.State
+
+		switch event.State {
+		case upgrade.NodeStarted:
+			c.nodeStarts[key] = event.Time
+		case upgrade.NodeCompleted:
+			if started, exists := c.nodeStarts[key]; exists {
+				if c.durations[event.Phase] == nil {
+					c.durations[event.Phase] = &histogram{}
+				}
+				c.durations[event.Phase].observe(event.Time.Sub(started).Seconds())
+				delete(c.nodeStarts, key)
+			}
+		case upgrade.NodeFailed:
+			c.failures[event.Phase]++
+			delete(c.nodeStarts, key)
+		case upgrade.NodeAborted:
+			delete(c.nodeStarts, key)
+		}
+	case upgrade.EventCompleted:
+		c.phase = phaseIdle
+		if event.Err != nil || (event.Result != nil && event.Result.HasErrors()) {
+			c.runs["failure"]++
+		} else {
+			c.runs["success"]++
+			c.lastSuccess = event.Time
+		}
+	case upgrade.EventNodeVersions:
+		c.nodes = make(map[string]upgrade.NodeVersions, len(event.Nodes))
+		for _, node := range event.Nodes {
+			c.nodes[node.Name] = node
+		}
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (c *Collector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := c.Write(w); err != nil {
+		log.Debug().Err(err).Msg("Failed to write metrics")
+	}
+}
+
+// Write writes the metrics in the Prometheus text exposition format
+func (c *Collector) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var b strings.Builder
+
+	writeHeader(&b, "water_node_info", "gauge", "Versions a node runs, always 1")
+	for _, name := range sortedKeys(c.nodes) {
+		node := c.nodes[name]
+		writeSample(&b, "water_node_info", 1,
+			"node", node.Name,
+			"control_plane", strconv.FormatBool(node.ControlPlane),
+			"talos_version", node.TalosVersion,
+			"kubelet_version", node.KubeletVersion)
+	}
+
+	writeHeader(&b, "water_node_up_to_date", "gauge", "Whether a node runs the configured Talos and Kubernetes versions")
+	for _, name := range sortedKeys(c.nodes) {
+		writeSample(&b, "water_node_up_to_date", boolValue(c.nodes[name].UpToDate), "node", name)
+	}
+
+	writeHeader(&b, "water_upgrade_phase", "gauge", "Phase the upgrade is in, 1 for the current phase")
+	for _, phase := range reportedPhases {
+		writeSample(&b, "water_upgrade_phase", boolValue(c.phase == phase), "phase", string(phase))
+	}
+
+	writeHeader(&b, "water_node_upgrade_state", "gauge", "Last state of a node in the current upgrade run, always 1")
+	keys := make([]nodeKey, 0, len(c.nodeStates))
+	for key := range c.nodeStates {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].node != keys[j].node {
+			return keys[i].node < keys[j].node
+		}
+		if keys[i].phase != keys[j].phase {
+			return keys[i].phase < keys[j].phase
+		}
+		return keys[i].targetVersion < keys[j].targetVersion
+	})
+	for _, key := range keys {
+		writeSample(&b, "water_node_upgrade_state", 1,
+			"node", key.node,
+			"phase", string(key.phase),
+			"target_version", key.targetVersion,
+			"state", string(c.nodeStates[key]))
+	}
+
+	writeHeader(&b, "water_node_upgrade_duration_seconds", "histogram", "Time a node took to upgrade")
+	for _, phase := range sortedKeys(c.durations) {
+		h := c.durations[phase]
+		for i, bound := range durationBuckets {
+			writeSample(&b, "water_node_upgrade_duration_seconds_bucket", float64(h.counts[i]),
+				"phase", string(phase), "le", strconv.FormatFloat(bound, 'f', -1, 64))
+		}
+		writeSample(&b, "water_node_upgrade_duration_seconds_bucket", float64(h.count), "phase", string(phase), "le", "+Inf")
+		writeSample(&b, "water_node_upgrade_duration_seconds_sum", h.sum, "phase", string(phase))
+		writeSample(&b, "water_node_upgrade_duration_seconds_count", float64(h.count), "phase", string(phase))
+	}
+
+	writeHeader(&b, "water_node_upgrade_failures_total", "counter", "Node upgrades that failed")
+	for _, phase := range sortedKeys(c.failures) {
+		writeSample(&b, "water_node_upgrade_failures_total", float64(c.failures[phase]), "phase", string(phase))
+	}
+
+	writeHeader(&b, "water_upgrade_runs_total", "counter", "Upgrade runs that completed, by result")
+	for _, result := range sortedKeys(c.runs) {
+		writeSample(&b, "water_upgrade_runs_total", float64(c.runs[result]), "result", result)
+	}
+
+	writeHeader(&b, "water_last_successful_run_timestamp_seconds", "gauge", "Unix time the last upgrade run without errors completed")
+	if !c.lastSuccess.IsZero() {
+		writeSample(&b, "water_last_successful_run_timestamp_seconds", float64(c.lastSuccess.Unix()))
+	}
+
+	writeHeader(&b, "water_release_fetch_errors_total", "counter", "Failed attempts to fetch releases from GitHub")
+	fetchErrors := version.ReleaseFetchErrors()
+	for _, releaseType := range sortedKeys(fetchErrors) {
+		writeSample(&b, "water_release_fetch_errors_total", float64(fetchErrors[releaseType]), "type", string(releaseType))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Start serves the metrics on address until the returned function is called
+func (c *Collector) Start(address string) func() {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", c)
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Info().Str("address", address).Msg("Serving metrics")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Str("address", address).Msg("Metrics server failed")
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to shut down metrics server")
+		}
+	}
+}
+
+// writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writeSample writes a sample with labels given as name/value pairs
+func writeSample(b *strings.Builder, name string, value float64, labels ...string) {
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=%q", labels[i], labels[i+1])
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(b, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// boolValue returns 1 for true and 0 for false
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// sortedKeys returns the keys of a map in order, so that the output is stable
+func sortedKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bouquet2/water/config"
+)
+
+// implicitTLSPort is the SMTP submission port that expects TLS from the first byte instead of STARTTLS
+const implicitTLSPort = 465
+
+// email mails notifications through an SMTP server
+type email struct {
+	config config.EmailConfig
+}
+
+// newEmail creates an email backend
+func newEmail(cfg config.EmailConfig) *email {
+	return &email{config: cfg}
+}
+
+// send mails a notification to every recipient. STARTTLS is used whenever the server offers it.
+func (e *email) send(ctx context.Context, notification Notification) error {
+	address := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	tlsConfig := &tls.Config{ServerName: e.config.Host}
+
+	var conn net.Conn
+	var err error
+	if e.config.Port == implicitTLSPort {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", address, err)
+	}
+	defer conn.Close()
+
+	// net/smtp has no context support, so the whole conversation is bounded by the connection deadline
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("failed to set SMTP deadline: %w", err)
+		}
+	}
+
+	client, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if e.config.Port != implicitTLSPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return fmt.Errorf("failed to start TLS: %w", err)
+			}
+		}
+	}
+
+	if e.config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(e.config.From); err != nil {
+		return fmt.Errorf("SMTP server refused sender %s: %w", e.config.From, err)
+	}
+	for _, recipient := range e.config.To {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP server refused recipient %s: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start SMTP message: %w", err)
+	}
+	if _, err := writer.Write(e.message(notification)); err != nil {
+		return fmt.Errorf("failed to write SMTP message: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to send SMTP message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// message renders a notification as a plain text email
+func (e *email) message(notification Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.config.To, ", "))
+	fmt.Fprintf(&b, "Subject: [water] %s\r\n", notification.Message)
+	fmt.Fprintf(&b, "Date: %s\r\n", notification.Time.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(notification.text(), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
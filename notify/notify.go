@@ -0,0 +1,339 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/upgrade"
+	"github.com/rs/zerolog/log"
+)
+
+// Notification events, as named in the events lists of the configuration
+const (
+	// EventStarted is sent when an upgrade run starts
+	EventStarted = "started"
+	// EventNode is sent when a node finishes or is rolled back
+	EventNode = "node"
+	// EventError is sent when a node fails or the run fails
+	EventError = "error"
+	// EventCompleted is sent when a run completes, with or without errors
+	EventCompleted = "completed"
+)
+
+// queueSize bounds how many notifications may wait for delivery before new ones are dropped
+const queueSize = 256
+
+// Notification is the payload sent to every backend
+type Notification struct {
+	Event         string    `json:"event"`
+	Time          time.Time `json:"time"`
+	Message       string    `json:"message"`
+	Phase         string    `json:"phase,omitempty"`
+	TargetVersion string    `json:"targetVersion,omitempty"`
+	Node          string    `json:"node,omitempty"`
+	State         string    `json:"state,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Result        *Result   `json:"result,omitempty"`
+}
+
+// Result holds the details of an upgrade.UpgradeResult
+type Result struct {
+	TalosUpgraded bool                  `json:"talosUpgraded"`
+	K8sUpgraded   bool                  `json:"k8sUpgraded"`
+	NodesUpgraded []string              `json:"nodesUpgraded,omitempty"`
+	FailedNodes   []string              `json:"failedNodes,omitempty"`
+	SkippedNodes  []upgrade.SkippedNode `json:"skippedNodes,omitempty"`
+	Rollbacks     []Rollback            `json:"rollbacks,omitempty"`
+	Errors        []string              `json:"errors,omitempty"`
+	Duration      string                `json:"duration"`
+}
+
+// Rollback holds the details of an upgrade.RollbackRecord
+type Rollback struct {
+	Node          string `json:"node"`
+	FailedVersion string `json:"failedVersion"`
+	TargetVersion string `json:"targetVersion"`
+	Succeeded     bool   `json:"succeeded"`
+	Error         string `json:"error,omitempty"`
+}
+
+// backend delivers notifications to a single destination
+type backend interface {
+	send(ctx context.Context, notification Notification) error
+}
+
+// destination is a backend together with the events it wants
+type destination struct {
+	name    string
+	events  []string
+	backend backend
+}
+
+// Notifier turns upgrade events into notifications and delivers them to the configured backends.
+// Delivery happens in the background in event order, so a slow backend never holds up the upgrade.
+type Notifier struct {
+	destinations []destination
+	timeout      time.Duration
+
+	mu     sync.Mutex
+	closed bool
+	queue  chan Notification
+	done   chan struct{}
+}
+
+// New creates a notifier for the configured backends
+func New(cfg config.NotificationsConfig) *Notifier {
+	n := &Notifier{timeout: cfg.Timeout}
+
+	for i, webhook := range cfg.Webhooks {
+		n.destinations = append(n.destinations, destination{
+			name:    fmt.Sprintf("webhook %d (%s)", i+1, webhook.Format),
+			events:  webhook.Events,
+			backend: newWebhook(webhook),
+		})
+	}
+	if cfg.Email.Enabled() {
+		n.destinations = append(n.destinations, destination{
+			name:    "email",
+			events:  cfg.Email.Events,
+			backend: newEmail(cfg.Email),
+		})
+	}
+
+	if len(n.destinations) > 0 {
+		n.queue = make(chan Notification, queueSize)
+		n.done = make(chan struct{})
+		go n.deliver()
+	}
+
+	return n
+}
+
+// HandleEvent queues the notifications for an upgrade event, it is meant to be registered with
+// upgrade.Manager.AddEventHandler
+func (n *Notifier) HandleEvent(event upgrade.Event) {
+	if len(n.destinations) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+
+	for _, notification := range notifications(event) {
+		select {
+		case n.queue <- notification:
+		default:
+			log.Warn().Str("event", notification.Event).Msg("Notification queue is full, dropping notification")
+		}
+	}
+}
+
+// Close delivers the queued notifications and stops the notifier
+func (n *Notifier) Close() {
+	if len(n.destinations) == 0 {
+		return
+	}
+
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.queue)
+	}
+	n.mu.Unlock()
+
+	<-n.done
+}
+
+// deliver sends queued notifications until the queue is closed. Failed deliveries are logged, not retried.
+func (n *Notifier) deliver() {
+	defer close(n.done)
+
+	for notification := range n.queue {
+		for _, destination := range n.destinations {
+			if len(destination.events) > 0 && !slices.Contains(destination.events, notification.Event) {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+			err := destination.backend.send(ctx, notification)
+			cancel()
+
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("destination", destination.name).
+					Str("event", notification.Event).
+					Msg("Failed to send notification")
+				continue
+			}
+
+			log.Debug().
+				Str("destination", destination.name).
+				Str("event", notification.Event).
+				Msg("Notification sent")
+		}
+	}
+}
+
+// notifications returns the notifications an upgrade event results in
+func notifications(event upgrade.Event) []Notification {
+	notification := Notification{
+		Time:          event.Time,
+		Phase:         string(event.Phase),
+		TargetVersion: event.TargetVersion,
+		Node:          event.Node,
+		State:         string(event.State),
+	}
+	if event.Err != nil {
+		notification.Error = event.Err.Error()
+	}
+
+	switch event.Type {
+	case upgrade.EventStarted:
+		notification.Event = EventStarted
+		notification.Message = startedMessage(event.Plan)
+	case upgrade.EventNode:
+		switch event.State {
+		case upgrade.NodeCompleted:
+			notification.Event = EventNode
+			notification.Message = fmt.Sprintf("Node %s finished its %s upgrade to %s", event.Node, phaseName(event.Phase), event.TargetVersion)
+		case upgrade.NodeRolledBack:
+			notification.Event = EventNode
+			notification.Message = fmt.Sprintf("Node %s was rolled back after failing its %s upgrade to %s", event.Node, phaseName(event.Phase), event.TargetVersion)
+		case upgrade.NodeFailed:
+			notification.Event = EventError
+			notification.Message = fmt.Sprintf("Node %s failed its %s upgrade to %s", event.Node, phaseName(event.Phase), event.TargetVersion)
+		default:
+			return nil
+		}
+	case upgrade.EventCompleted:
+		notification.Result = newResult(event.Result)
+		if event.Err != nil {
+			notification.Event = EventError
+			notification.Message = "Upgrade failed"
+			return []Notification{notification}
+		}
+		notification.Event = EventCompleted
+		notification.Message = completedMessage(event.Result)
+	default:
+		return nil
+	}
+
+	return []Notification{notification}
+}
+
+// startedMessage describes the upgrade a plan performs
+func startedMessage(plan *upgrade.Plan) string {
+	if plan == nil {
+		return "Upgrade started"
+	}
+
+	var parts []string
+	if plan.Talos.Current != plan.Talos.Target {
+		parts = append(parts, fmt.Sprintf("Talos %s -> %s", plan.Talos.Current, plan.Talos.Target))
+	}
+	if plan.Kubernetes.Current != plan.Kubernetes.Target {
+		parts = append(parts, fmt.Sprintf("Kubernetes %s -> %s", plan.Kubernetes.Current, plan.Kubernetes.Target))
+	}
+	if len(parts) == 0 {
+		return "Upgrade started, cluster is already up to date"
+	}
+
+	return "Upgrade started: " + strings.Join(parts, ", ")
+}
+
+// completedMessage summarizes the outcome of a run
+func completedMessage(result *upgrade.UpgradeResult) string {
+	if result == nil {
+		return "Upgrade completed"
+	}
+	if result.HasErrors() {
+		return fmt.Sprintf("Upgrade completed with %d errors after %s", len(result.Errors), result.UpgradeDuration.Round(time.Second))
+	}
+	if !result.TalosUpgraded && !result.K8sUpgraded {
+		return "Upgrade completed, no upgrades were needed"
+	}
+	return fmt.Sprintf("Upgrade completed successfully after %s: Talos upgraded=%t, Kubernetes upgraded=%t",
+		result.UpgradeDuration.Round(time.Second), result.TalosUpgraded, result.K8sUpgraded)
+}
+
+// newResult copies the details of an upgrade result into the payload
+func newResult(result *upgrade.UpgradeResult) *Result {
+	if result == nil {
+		return nil
+	}
+
+	details := &Result{
+		TalosUpgraded: result.TalosUpgraded,
+		K8sUpgraded:   result.K8sUpgraded,
+		NodesUpgraded: result.NodesUpgraded,
+		FailedNodes:   result.FailedNodes,
+		SkippedNodes:  result.SkippedNodes,
+		Duration:      result.UpgradeDuration.Round(time.Second).String(),
+	}
+	for _, rollback := range result.Rollbacks {
+		details.Rollbacks = append(details.Rollbacks, Rollback{
+			Node:          rollback.Node,
+			FailedVersion: rollback.FailedVersion,
+			TargetVersion: rollback.TargetVersion,
+			Succeeded:     rollback.Succeeded,
+			Error:         rollback.Error,
+		})
+	}
+	for _, err := range result.Errors {
+		details.Errors = append(details.Errors, err.Error())
+	}
+
+	return details
+}
+
+// phaseName returns the name of an upgrade phase as shown in messages
+func phaseName(phase upgrade.Phase) string {
+	switch phase {
+	case upgrade.PhaseTalos:
+		return "Talos"
+	case upgrade.PhaseKubernetes:
+		return "Kubernetes"
+	default:
+		return string(phase)
+	}
+}
+
+// text renders a notification as plain text for chat messages and emails
+func (n Notification) text() string {
+	var b strings.Builder
+	b.WriteString(n.Message)
+	if n.Error != "" {
+		fmt.Fprintf(&b, ": %s", n.Error)
+	}
+
+	if n.Result != nil {
+		fmt.Fprintf(&b, "\n\nDuration: %s", n.Result.Duration)
+		fmt.Fprintf(&b, "\nTalos upgraded: %t, Kubernetes upgraded: %t", n.Result.TalosUpgraded, n.Result.K8sUpgraded)
+		if len(n.Result.NodesUpgraded) > 0 {
+			fmt.Fprintf(&b, "\nUpgraded nodes: %s", strings.Join(n.Result.NodesUpgraded, ", "))
+		}
+		if len(n.Result.FailedNodes) > 0 {
+			fmt.Fprintf(&b, "\nFailed nodes: %s", strings.Join(n.Result.FailedNodes, ", "))
+		}
+		for _, skipped := range n.Result.SkippedNodes {
+			fmt.Fprintf(&b, "\nSkipped %s: %s", skipped.Name, skipped.Reason)
+		}
+		for _, rollback := range n.Result.Rollbacks {
+			fmt.Fprintf(&b, "\nRolled back %s from %s (succeeded: %t)", rollback.Node, rollback.FailedVersion, rollback.Succeeded)
+		}
+		for _, err := range n.Result.Errors {
+			fmt.Fprintf(&b, "\nError: %s", err)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bouquet2/water/config"
+)
+
+// discordMessageLimit is the longest message content Discord accepts
+const discordMessageLimit = 2000
+
+// webhook posts notifications to an HTTP endpoint as generic JSON or as a Slack or Discord message
+type webhook struct {
+	config config.WebhookConfig
+	client *http.Client
+}
+
+// newWebhook creates a webhook backend
+func newWebhook(cfg config.WebhookConfig) *webhook {
+	return &webhook{config: cfg, client: &http.Client{}}
+}
+
+// send posts a notification in the configured format
+func (w *webhook) send(ctx context.Context, notification Notification) error {
+	var payload any
+	switch w.config.Format {
+	case "slack":
+		payload = map[string]string{"text": notification.text()}
+	case "discord":
+		content := notification.text()
+		if runes := []rune(content); len(runes) > discordMessageLimit {
+			content = string(runes[:discordMessageLimit-3]) + "..."
+		}
+		payload = map[string]string{"content": content}
+	default:
+		payload = notification
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range w.config.Headers {
+		request.Header.Set(name, value)
+	}
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %s", response.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/metrics"
+	"github.com/bouquet2/water/notify"
+	"github.com/bouquet2/water/talos"
+	"github.com/bouquet2/water/upgrade"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// watchRetryDelay is the pause before watching ClusterUpgrades again after the watch could not be started
+const watchRetryDelay = 30 * time.Second
+
+// RetryAnnotation retries an upgrade that failed for the current spec. Every new value, e.g. the current
+// time, allows one more attempt; the value last acted on is kept in status.lastHandledRetry.
+const RetryAnnotation = "water.bouquet2/retry"
+
+// Condition reasons of failed and held upgrades
+const (
+	ReasonUpgradeFailed      = "UpgradeFailed"
+	ReasonUpgradeInterrupted = "UpgradeInterrupted"
+	ReasonUpgradeHeld        = "UpgradeHeld"
+)
+
+// Options configures the operator
+type Options struct {
+	TalosConfigPath string
+	// JournalDir holds the upgrade journal of every ClusterUpgrade that does not set journal.path
+	JournalDir string
+	// Interval is the time between periodic reconciliations, spec changes are reconciled right away
+	Interval time.Duration
+	// Metrics records every reconciliation, it may be nil
+	Metrics *metrics.Collector
+}
+
+// Operator reconciles ClusterUpgrade resources, upgrading the cluster to the versions in their spec
+type Operator struct {
+	opts Options
+}
+
+// New creates a new operator
+func New(opts Options) *Operator {
+	return &Operator{opts: opts}
+}
+
+// Run reconciles until ctx is cancelled. An upgrade in progress when ctx is cancelled finishes the nodes
+// it is working on and then stops, so that no node is left half upgraded.
+func (o *Operator) Run(ctx context.Context) error {
+	log.Info().
+		Dur("interval", o.opts.Interval).
+		Str("resource", k8s.ClusterUpgradeResource.String()).
+		Msg("Starting water operator")
+
+	changes := make(chan struct{}, 1)
+	watching := false
+
+	for {
+		list := o.reconcileAll(ctx)
+
+		// Watching from the list just reconciled leaves out the ADDED events of the ClusterUpgrades it
+		// contains, which would otherwise reconcile them a second time right away
+		if !watching && list != nil {
+			go o.watch(ctx, list, changes)
+			watching = true
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info().Msg("Shutting down water operator")
+			return nil
+		case <-changes:
+			log.Info().Msg("ClusterUpgrade spec changed, reconciling")
+		case <-time.After(o.opts.Interval):
+		}
+	}
+}
+
+// trigger is what of a ClusterUpgrade reconciles it right away when it changes
+type trigger struct {
+	generation int64
+	retry      string
+}
+
+// triggerOf returns the spec generation and retry annotation of a ClusterUpgrade
+func triggerOf(clusterUpgrade *unstructured.Unstructured) trigger {
+	return trigger{
+		generation: clusterUpgrade.GetGeneration(),
+		retry:      clusterUpgrade.GetAnnotations()[RetryAnnotation],
+	}
+}
+
+// watch signals changes whenever the spec or the retry annotation of a ClusterUpgrade changes, starting
+// after list. Status updates leave both alone, so the operator's own writes do not trigger another
+// reconciliation.
+func (o *Operator) watch(ctx context.Context, list *unstructured.UnstructuredList, changes chan<- struct{}) {
+	triggers := make(map[string]trigger)
+	for i := range list.Items {
+		triggers[list.Items[i].GetName()] = triggerOf(&list.Items[i])
+	}
+	resourceVersion := list.GetResourceVersion()
+
+	for ctx.Err() == nil {
+		watcher, err := k8s.WatchClusterUpgrades(ctx, resourceVersion)
+		if err != nil {
+			log.Warn().Err(err).Dur("retry_in", watchRetryDelay).Msg("Failed to watch ClusterUpgrades")
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(watchRetryDelay):
+			}
+			continue
+		}
+
+		for event := range watcher.ResultChan() {
+			if event.Type == watch.Error {
+				// The resource version may have expired, start over from the current ClusterUpgrades
+				resourceVersion = ""
+				continue
+			}
+
+			clusterUpgrade, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			resourceVersion = clusterUpgrade.GetResourceVersion()
+
+			name := clusterUpgrade.GetName()
+			if event.Type == watch.Deleted {
+				delete(triggers, name)
+				continue
+			}
+			if current, known := triggers[name]; known && current == triggerOf(clusterUpgrade) {
+				continue
+			}
+			triggers[name] = triggerOf(clusterUpgrade)
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+		watcher.Stop()
+	}
+}
+
+// reconcileAll reconciles every ClusterUpgrade, one after another in name order, since they all
+// act on the same cluster. It returns the list it reconciled, or nil if it could not be listed.
+func (o *Operator) reconcileAll(ctx context.Context) *unstructured.UnstructuredList {
+	list, err := k8s.ListClusterUpgrades(context.WithoutCancel(ctx))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to list ClusterUpgrades, will retry at the next interval")
+		return nil
+	}
+
+	clusterUpgrades := list.Items
+	sort.Slice(clusterUpgrades, func(i, j int) bool {
+		return clusterUpgrades[i].GetName() < clusterUpgrades[j].GetName()
+	})
+
+	if len(clusterUpgrades) == 0 {
+		log.Info().Msg("No ClusterUpgrades found")
+	} else if len(clusterUpgrades) > 1 {
+		log.Warn().Int("count", len(clusterUpgrades)).Msg("Several ClusterUpgrades found, they may work against each other")
+	}
+
+	for i := range clusterUpgrades {
+		if ctx.Err() != nil {
+			log.Info().Msg("Shutting down, leaving the remaining ClusterUpgrades to the next start")
+			return list
+		}
+		o.reconcile(ctx, &clusterUpgrades[i])
+	}
+
+	return list
+}
+
+// reconcile brings the cluster to the versions of one ClusterUpgrade. Errors, including panics,
+// are recorded in its status instead of stopping the operator.
+func (o *Operator) reconcile(ctx context.Context, clusterUpgrade *unstructured.Unstructured) {
+	status := newStatusWriter(context.WithoutCancel(ctx), clusterUpgrade)
+
+	log.Info().
+		Str("cluster_upgrade", clusterUpgrade.GetName()).
+		Int64("generation", clusterUpgrade.GetGeneration()).
+		Msg("Reconciling ClusterUpgrade")
+
+	defer func() {
+		if r := recover(); r != nil {
+			status.fail(PhaseFailed, "Panic", fmt.Errorf("reconciliation panicked: %v", r))
+		}
+	}()
+
+	o.reconcileOnce(ctx, clusterUpgrade, status)
+}
+
+// reconcileOnce reads the spec, checks the cluster and upgrades it if it drifted and the maintenance
+// windows allow it
+func (o *Operator) reconcileOnce(ctx context.Context, clusterUpgrade *unstructured.Unstructured, status *statusWriter) {
+	cfg, err := specConfig(clusterUpgrade)
+	if err != nil {
+		status.fail(PhaseInvalid, "InvalidSpec", err)
+		return
+	}
+
+	talosClient, err := talos.NewClient(o.opts.TalosConfigPath)
+	if err != nil {
+		status.fail(PhaseFailed, "TalosUnavailable", fmt.Errorf("failed to create Talos client: %w", err))
+		return
+	}
+	defer func() {
+		if err := talosClient.Close(); err != nil {
+			log.Error().Err(err).Msg("Failed to close Talos client")
+		}
+	}()
+
+	upgradeManager := upgrade.NewManager(talosClient, cfg)
+	if o.opts.Metrics != nil {
+		upgradeManager.AddEventHandler(o.opts.Metrics.HandleEvent)
+	}
+
+	// Shutting down stops the upgrade once the nodes in progress are done instead of cutting them short
+	stopOnShutdown := context.AfterFunc(ctx, upgradeManager.Stop)
+	defer stopOnShutdown()
+	ctx = context.WithoutCancel(ctx)
+
+	check, err := upgradeManager.Check(ctx)
+	if err != nil {
+		status.fail(PhaseFailed, "CheckFailed", fmt.Errorf("version check failed: %w", err))
+		return
+	}
+
+	if !check.NeedsUpgrade() {
+		status.update(func(s *Status) {
+			s.Phase = PhaseUpToDate
+			s.CurrentTalosVersion = check.CurrentTalos
+			s.CurrentKubernetesVersion = check.CurrentK8s
+			status.setCondition(s, ConditionReady, metav1.ConditionTrue, PhaseUpToDate, "cluster runs the versions of the spec")
+			status.setCondition(s, ConditionProgressing, metav1.ConditionFalse, PhaseUpToDate, "")
+			status.setCondition(s, ConditionFailed, metav1.ConditionFalse, PhaseUpToDate, "")
+		})
+		return
+	}
+
+	drift := fmt.Sprintf("Talos %s -> %s, Kubernetes %s -> %s",
+		check.CurrentTalos, check.TargetTalos, check.CurrentK8s, check.TargetK8s)
+
+	// Upgrading again to a spec that failed would drain, reboot and possibly roll back the same nodes
+	// at every reconciliation
+	retry := clusterUpgrade.GetAnnotations()[RetryAnnotation]
+	if status.upgradeHeld(retry) {
+		log.Warn().
+			Str("cluster_upgrade", status.name).
+			Msg("Upgrade to this spec failed before - skipping until the spec changes or the retry annotation is set")
+		status.update(func(s *Status) {
+			s.CurrentTalosVersion = check.CurrentTalos
+			s.CurrentKubernetesVersion = check.CurrentK8s
+			status.setCondition(s, ConditionProgressing, metav1.ConditionFalse, ReasonUpgradeHeld,
+				fmt.Sprintf("upgrade failed for this spec, change the spec or set the %s annotation to retry", RetryAnnotation))
+		})
+		return
+	}
+
+	if cfg.Maintenance.Enabled() {
+		if _, open := cfg.Maintenance.WindowEnd(time.Now()); !open {
+			message := "upgrade postponed until the next maintenance window"
+			if next, found := cfg.Maintenance.NextWindowStart(time.Now()); found {
+				message = fmt.Sprintf("upgrade postponed until the maintenance window opening at %s", next.Format(time.RFC3339))
+			}
+
+			log.Info().Str("cluster_upgrade", status.name).Msg("Outside maintenance window - upgrade postponed")
+			status.update(func(s *Status) {
+				s.Phase = PhaseWaitingForMaintenanceWindow
+				s.CurrentTalosVersion = check.CurrentTalos
+				s.CurrentKubernetesVersion = check.CurrentK8s
+				status.setCondition(s, ConditionReady, metav1.ConditionFalse, PhaseDrifted, drift)
+				status.setCondition(s, ConditionProgressing, metav1.ConditionFalse, PhaseWaitingForMaintenanceWindow, message)
+			})
+			return
+		}
+	}
+
+	// Continue an upgrade an earlier reconciliation or a restart left unfinished
+	journalPath := cfg.Journal.Path
+	if journalPath == "" {
+		journalPath = filepath.Join(o.opts.JournalDir, status.name+".json")
+	}
+	journal, err := upgrade.OpenJournal(journalPath, upgrade.CanResumeJournal(journalPath, cfg), cfg)
+	if err != nil {
+		status.fail(PhaseFailed, "JournalUnavailable", fmt.Errorf("failed to open upgrade journal: %w", err))
+		return
+	}
+	upgradeManager.SetJournal(journal)
+	upgradeManager.AddEventHandler(status.handleEvent)
+
+	notifier := notify.New(cfg.Notifications)
+	defer notifier.Close()
+	upgradeManager.AddEventHandler(notifier.HandleEvent)
+
+	status.update(func(s *Status) {
+		s.Phase = PhaseUpgrading
+		s.LastHandledRetry = retry
+		s.CurrentTalosVersion = check.CurrentTalos
+		s.CurrentKubernetesVersion = check.CurrentK8s
+		status.setCondition(s, ConditionReady, metav1.ConditionFalse, PhaseDrifted, drift)
+		status.setCondition(s, ConditionProgressing, metav1.ConditionTrue, PhaseUpgrading, drift)
+		// A restart during this attempt resumes it from the journal instead of holding it
+		status.setCondition(s, ConditionFailed, metav1.ConditionFalse, PhaseUpgrading, "")
+	})
+
+	result, err := upgradeManager.PerformUpgrade(ctx)
+	if err == nil && result.HasErrors() {
+		err = fmt.Errorf("upgrade completed with errors: %w", errors.Join(result.Errors...))
+	}
+	if err != nil {
+		// An interrupted upgrade continues from its journal at the next start, a failed one is held
+		reason := ReasonUpgradeFailed
+		if result != nil && result.Interrupted {
+			reason = ReasonUpgradeInterrupted
+		}
+		status.fail(PhaseFailed, reason, err)
+		return
+	}
+
+	status.update(func(s *Status) {
+		s.Phase = PhaseUpToDate
+		s.CurrentTalosVersion = check.TargetTalos
+		s.CurrentKubernetesVersion = check.TargetK8s
+		status.setCondition(s, ConditionReady, metav1.ConditionTrue, "Upgraded", "cluster runs the versions of the spec")
+		status.setCondition(s, ConditionProgressing, metav1.ConditionFalse, "Upgraded", "")
+		status.setCondition(s, ConditionFailed, metav1.ConditionFalse, "Upgraded", "")
+	})
+}
+
+// specConfig reads the configuration from the spec of a ClusterUpgrade, which has the same fields as water.yaml,
+// and checks that its Talos and Kubernetes versions are compatible
+func specConfig(clusterUpgrade *unstructured.Unstructured) (*config.Config, error) {
+	spec, found, err := unstructured.NestedMap(clusterUpgrade.Object, "spec")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("spec is missing")
+	}
+
+	cfg, err := config.FromMap(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	compatibility, err := version.LoadCompatibilityMatrix(cfg.Compatibility.OverrideFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load compatibility matrix: %w", err)
+	}
+	if err := compatibility.Check(cfg.Talos.Version, cfg.K8s.Version); err != nil {
+		return nil, fmt.Errorf("Talos and Kubernetes versions are not compatible: %w", err)
+	}
+
+	return cfg, nil
+}
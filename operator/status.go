@@ -0,0 +1,217 @@
+package operator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/upgrade"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ClusterUpgrade phases reported in Status.Phase
+const (
+	PhaseUpToDate                    = "UpToDate"
+	PhaseDrifted                     = "Drifted"
+	PhaseWaitingForMaintenanceWindow = "WaitingForMaintenanceWindow"
+	PhaseUpgrading                   = "Upgrading"
+	PhaseFailed                      = "Failed"
+	PhaseInvalid                     = "Invalid"
+)
+
+// Condition types of a ClusterUpgrade. Each node additionally gets a condition named
+// NodeConditionPrefix followed by the node name.
+const (
+	// ConditionReady is true when the cluster runs the versions of the spec
+	ConditionReady = "Ready"
+	// ConditionProgressing is true while an upgrade runs
+	ConditionProgressing = "Progressing"
+	// ConditionFailed is true when the last reconciliation failed
+	ConditionFailed = "Failed"
+	// NodeConditionPrefix starts the condition type of a node, e.g. "node.water.bouquet2/worker-1"
+	NodeConditionPrefix = "node.water.bouquet2/"
+)
+
+// Status is the status of a ClusterUpgrade
+type Status struct {
+	ObservedGeneration       int64              `json:"observedGeneration,omitempty"`
+	Phase                    string             `json:"phase,omitempty"`
+	CurrentTalosVersion      string             `json:"currentTalosVersion,omitempty"`
+	CurrentKubernetesVersion string             `json:"currentKubernetesVersion,omitempty"`
+	LastHandledRetry         string             `json:"lastHandledRetry,omitempty"`
+	LastReconcileTime        *metav1.Time       `json:"lastReconcileTime,omitempty"`
+	Conditions               []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// nodeConditionReasons maps node states to the reasons of their conditions
+var nodeConditionReasons = map[upgrade.NodeState]string{
+	upgrade.NodePending:          "Pending",
+	upgrade.NodeStarted:          "Upgrading",
+	upgrade.NodeUpgradeInitiated: "UpgradeInitiated",
+	upgrade.NodeCompleted:        "Upgraded",
+	upgrade.NodeFailed:           "UpgradeFailed",
+	upgrade.NodeRolledBack:       "RolledBack",
+	upgrade.NodeAborted:          "Aborted",
+}
+
+// statusWriter holds the status of one ClusterUpgrade during a reconciliation and writes every change
+// to the API server. Upgrade events of parallel nodes arrive concurrently, so changes are serialized.
+type statusWriter struct {
+	ctx        context.Context
+	name       string
+	generation int64
+
+	mu     sync.Mutex
+	status Status
+}
+
+// newStatusWriter starts from the status already stored in the resource, so that condition
+// transition times survive reconciliations
+func newStatusWriter(ctx context.Context, clusterUpgrade *unstructured.Unstructured) *statusWriter {
+	w := &statusWriter{
+		ctx:        ctx,
+		name:       clusterUpgrade.GetName(),
+		generation: clusterUpgrade.GetGeneration(),
+	}
+
+	if status, found, _ := unstructured.NestedMap(clusterUpgrade.Object, "status"); found {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(status, &w.status); err != nil {
+			log.Warn().Err(err).Str("cluster_upgrade", w.name).Msg("Ignoring unreadable ClusterUpgrade status")
+			w.status = Status{}
+		}
+	}
+
+	return w
+}
+
+// update applies change to the status and writes it. Failing to write the status is logged
+// but does not stop the upgrade, the next change or reconciliation writes it again.
+func (w *statusWriter) update(change func(status *Status)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	change(&w.status)
+	w.status.ObservedGeneration = w.generation
+	now := metav1.Now()
+	w.status.LastReconcileTime = &now
+
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&w.status)
+	if err != nil {
+		log.Error().Err(err).Str("cluster_upgrade", w.name).Msg("Failed to convert ClusterUpgrade status")
+		return
+	}
+
+	if err := k8s.UpdateClusterUpgradeStatus(w.ctx, w.name, status); err != nil {
+		log.Error().Err(err).Str("cluster_upgrade", w.name).Msg("Failed to update ClusterUpgrade status")
+	}
+}
+
+// setCondition adds or updates a condition of the status, stamped with the reconciled generation
+func (w *statusWriter) setCondition(status *Status, conditionType string, conditionStatus metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             conditionStatus,
+		ObservedGeneration: w.generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// upgradeHeld reports whether the upgrade failed for the reconciled generation and retry was already
+// acted on. Interrupted upgrades are not held, their journal resumes them.
+func (w *statusWriter) upgradeHeld(retry string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	failed := meta.FindStatusCondition(w.status.Conditions, ConditionFailed)
+	if failed == nil || failed.Status != metav1.ConditionTrue || failed.Reason != ReasonUpgradeFailed {
+		return false
+	}
+	return failed.ObservedGeneration == w.generation && w.status.LastHandledRetry == retry
+}
+
+// fail records a failed reconciliation
+func (w *statusWriter) fail(phase, reason string, err error) {
+	log.Error().Err(err).Str("cluster_upgrade", w.name).Str("reason", reason).Msg("ClusterUpgrade reconciliation failed")
+
+	w.update(func(status *Status) {
+		status.Phase = phase
+
+		// A failure before the upgrade, e.g. an unreachable node, must not replace a failed upgrade
+		// of this generation, which would release its hold
+		failed := meta.FindStatusCondition(status.Conditions, ConditionFailed)
+		upgradeOutcome := reason == ReasonUpgradeFailed || reason == ReasonUpgradeInterrupted
+		if failed != nil && failed.Status == metav1.ConditionTrue && failed.Reason == ReasonUpgradeFailed &&
+			failed.ObservedGeneration == w.generation && !upgradeOutcome && phase != PhaseInvalid {
+			w.setCondition(status, ConditionProgressing, metav1.ConditionFalse, reason, err.Error())
+		} else {
+			w.setCondition(status, ConditionFailed, metav1.ConditionTrue, reason, err.Error())
+			w.setCondition(status, ConditionProgressing, metav1.ConditionFalse, reason, "")
+		}
+		if meta.FindStatusCondition(status.Conditions, ConditionReady) == nil {
+			w.setCondition(status, ConditionReady, metav1.ConditionUnknown, reason, "")
+		}
+	})
+}
+
+// handleEvent writes the progress of the upgrade into the conditions
+func (w *statusWriter) handleEvent(event upgrade.Event) {
+	switch event.Type {
+	case upgrade.EventStarted:
+		// Every node the plan touches is pending until its first step starts
+		w.update(func(status *Status) {
+			pending := make(map[string]bool)
+			for _, step := range event.Plan.Steps {
+				for _, wave := range step.Waves {
+					for _, node := range wave.Nodes {
+						if pending[node.Name] {
+							continue
+						}
+						pending[node.Name] = true
+						w.setCondition(status, NodeConditionPrefix+node.Name, metav1.ConditionUnknown,
+							nodeConditionReasons[upgrade.NodePending], fmt.Sprintf("waiting for %s %s", phaseName(step.Phase), step.Version))
+					}
+				}
+			}
+		})
+	case upgrade.EventPhaseStarted:
+		w.update(func(status *Status) {
+			w.setCondition(status, ConditionProgressing, metav1.ConditionTrue, PhaseUpgrading,
+				fmt.Sprintf("upgrading %s to %s", phaseName(event.Phase), event.TargetVersion))
+		})
+	case upgrade.EventNode:
+		conditionStatus := metav1.ConditionUnknown
+		switch event.State {
+		case upgrade.NodeCompleted:
+			conditionStatus = metav1.ConditionTrue
+		case upgrade.NodeFailed, upgrade.NodeRolledBack:
+			conditionStatus = metav1.ConditionFalse
+		}
+
+		message := fmt.Sprintf("%s %s: %s", phaseName(event.Phase), event.TargetVersion, event.State)
+		if event.Err != nil {
+			message = fmt.Sprintf("%s: %v", message, event.Err)
+		}
+
+		w.update(func(status *Status) {
+			w.setCondition(status, NodeConditionPrefix+event.Node, conditionStatus, nodeConditionReasons[event.State], message)
+		})
+	}
+}
+
+// phaseName returns the name of an upgrade phase as shown in condition messages
+func phaseName(phase upgrade.Phase) string {
+	switch phase {
+	case upgrade.PhaseTalos:
+		return "Talos"
+	case upgrade.PhaseKubernetes:
+		return "Kubernetes"
+	default:
+		return string(phase)
+	}
+}
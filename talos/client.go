@@ -14,7 +14,6 @@ import (
 // Client wraps the Talos machinery client with additional functionality
 type Client struct {
 	client       *client.Client
-	ctx          context.Context
 	clientConfig *config.Config
 }
 
@@ -59,7 +58,6 @@ func NewClient(configPath string) (*Client, error) {
 
 	return &Client{
 		client:       c,
-		ctx:          context.Background(),
 		clientConfig: clientConfig,
 	}, nil
 }
@@ -156,7 +154,7 @@ func (c *Client) buildNodeEndpointCache(ctx context.Context) error {
 
 		nodeEndpointCache[hostname] = endpoint
 		log.Info().
-			Str("hostname", hostname).
+			Str("node", hostname).
 			Str("endpoint", endpoint).
 			Msg("Cached node endpoint mapping")
 	}
@@ -196,7 +194,7 @@ func (c *Client) getHostnameFromEndpoint(ctx context.Context, endpoint string) (
 		if message.Hostname != "" {
 			log.Debug().
 				Str("endpoint", endpoint).
-				Str("hostname", message.Hostname).
+				Str("node", message.Hostname).
 				Msg("Successfully retrieved hostname from Talos endpoint")
 			return message.Hostname, nil
 		}
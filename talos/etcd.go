@@ -0,0 +1,179 @@
+package talos
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	machineapi "github.com/siderolabs/talos/pkg/machinery/api/machine"
+)
+
+// EtcdMemberHealth holds the health of a single etcd member
+type EtcdMemberHealth struct {
+	ID        uint64
+	Hostname  string
+	IsLearner bool
+	Healthy   bool
+	Errors    []string
+}
+
+// EtcdHealth holds the health of the etcd cluster as reported through the Talos API
+type EtcdHealth struct {
+	Members []EtcdMemberHealth
+	Alarms  []string
+}
+
+// Voters returns the number of voting (non-learner) members
+func (h *EtcdHealth) Voters() int {
+	voters := 0
+	for _, member := range h.Members {
+		if !member.IsLearner {
+			voters++
+		}
+	}
+	return voters
+}
+
+// HealthyVoters returns the number of healthy voting members
+func (h *EtcdHealth) HealthyVoters() int {
+	healthy := 0
+	for _, member := range h.Members {
+		if !member.IsLearner && member.Healthy {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Quorum returns the number of voting members needed for etcd to keep quorum
+func (h *EtcdHealth) Quorum() int {
+	return h.Voters()/2 + 1
+}
+
+// UnhealthyMembers returns the hostnames of members that are not healthy
+func (h *EtcdHealth) UnhealthyMembers() []string {
+	var unhealthy []string
+	for _, member := range h.Members {
+		if !member.Healthy {
+			unhealthy = append(unhealthy, member.Hostname)
+		}
+	}
+	return unhealthy
+}
+
+// GetEtcdHealth queries etcd membership, member status and alarms through the Talos API.
+// controlPlaneEndpoints maps control plane node names, which match etcd member hostnames, to their Talos endpoints.
+func (c *Client) GetEtcdHealth(ctx context.Context, controlPlaneEndpoints map[string]string) (*EtcdHealth, error) {
+	if len(controlPlaneEndpoints) == 0 {
+		return nil, fmt.Errorf("no control plane endpoints to query etcd through")
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Membership and alarms are cluster-wide, so any reachable control plane node can answer
+	var members []*machineapi.EtcdMember
+	var alarms []string
+	var lastErr error
+	for _, endpoint := range controlPlaneEndpoints {
+		members, alarms, lastErr = c.getEtcdMembersAndAlarms(timeoutCtx, endpoint)
+		if lastErr == nil {
+			break
+		}
+		log.Debug().Err(lastErr).Str("endpoint", endpoint).Msg("Failed to query etcd through endpoint, trying next")
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf("failed to query etcd members: %w", lastErr)
+	}
+
+	health := &EtcdHealth{Alarms: alarms}
+
+	// Member status has to be asked from each member's own node
+	for _, member := range members {
+		memberHealth := EtcdMemberHealth{
+			ID:        member.Id,
+			Hostname:  member.Hostname,
+			IsLearner: member.IsLearner,
+		}
+
+		endpoint, exists := controlPlaneEndpoints[member.Hostname]
+		if !exists {
+			memberHealth.Errors = []string{"no Talos endpoint known for member"}
+		} else {
+			memberHealth.Errors = c.getEtcdMemberErrors(timeoutCtx, endpoint)
+		}
+		memberHealth.Healthy = len(memberHealth.Errors) == 0
+
+		health.Members = append(health.Members, memberHealth)
+	}
+
+	log.Debug().
+		Int("members", len(health.Members)).
+		Int("healthy_voters", health.HealthyVoters()).
+		Int("quorum", health.Quorum()).
+		Strs("alarms", health.Alarms).
+		Msg("Retrieved etcd health")
+
+	return health, nil
+}
+
+// getEtcdMembersAndAlarms lists etcd members and active alarms through a single node
+func (c *Client) getEtcdMembersAndAlarms(ctx context.Context, endpoint string) ([]*machineapi.EtcdMember, []string, error) {
+	nodeClient, err := c.CreateNodeClient(endpoint)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create client for endpoint %s: %w", endpoint, err)
+	}
+	defer nodeClient.Close()
+
+	memberResp, err := nodeClient.EtcdMemberList(ctx, &machineapi.EtcdMemberListRequest{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list etcd members: %w", err)
+	}
+
+	var members []*machineapi.EtcdMember
+	for _, message := range memberResp.Messages {
+		members = append(members, message.Members...)
+	}
+
+	alarmResp, err := nodeClient.EtcdAlarmList(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list etcd alarms: %w", err)
+	}
+
+	var alarms []string
+	for _, message := range alarmResp.Messages {
+		for _, alarm := range message.MemberAlarms {
+			if alarm.Alarm != machineapi.EtcdMemberAlarm_NONE {
+				alarms = append(alarms, fmt.Sprintf("%s on member %x", alarm.Alarm.String(), alarm.MemberId))
+			}
+		}
+	}
+
+	return members, alarms, nil
+}
+
+// getEtcdMemberErrors returns the problems reported by the etcd member running on a node, if any
+func (c *Client) getEtcdMemberErrors(ctx context.Context, endpoint string) []string {
+	nodeClient, err := c.CreateNodeClient(endpoint)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to create client: %v", err)}
+	}
+	defer nodeClient.Close()
+
+	statusResp, err := nodeClient.EtcdStatus(ctx)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to get status: %v", err)}
+	}
+
+	var errors []string
+	for _, message := range statusResp.Messages {
+		if message.MemberStatus == nil {
+			errors = append(errors, "no member status reported")
+			continue
+		}
+		errors = append(errors, message.MemberStatus.Errors...)
+	}
+
+	return errors
+}
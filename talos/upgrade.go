@@ -7,6 +7,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/siderolabs/talos/pkg/machinery/client"
+	"google.golang.org/protobuf/types/known/emptypb"
 )
 
 // UpgradeNode performs a Talos upgrade on a single node
@@ -37,6 +38,31 @@ func (c *Client) UpgradeNode(ctx context.Context, nodeEndpoint, imageID string)
 	return nil
 }
 
+// RollbackNode reverts a node to the Talos version it was running before its last upgrade.
+// The node reboots into the previous version, use WaitForNodeReboot to wait for it.
+func (c *Client) RollbackNode(ctx context.Context, nodeEndpoint string) error {
+	log.Info().
+		Str("node", nodeEndpoint).
+		Msg("Rolling back Talos on single node")
+
+	// Create a client specifically for this node
+	nodeClient, err := c.CreateNodeClient(nodeEndpoint)
+	if err != nil {
+		return fmt.Errorf("failed to create client for node %s: %w", nodeEndpoint, err)
+	}
+	defer nodeClient.Close()
+
+	if err := nodeClient.Rollback(ctx); err != nil {
+		return fmt.Errorf("failed to initiate Talos rollback on node %s: %w", nodeEndpoint, err)
+	}
+
+	log.Debug().
+		Str("node", nodeEndpoint).
+		Msg("Rollback initiated on node")
+
+	return nil
+}
+
 // CreateNodeClient creates a Talos client for a specific node
 func (c *Client) CreateNodeClient(nodeEndpoint string) (*client.Client, error) {
 	// Create client options for the specific node using stored configuration
@@ -54,8 +80,33 @@ func (c *Client) CreateNodeClient(nodeEndpoint string) (*client.Client, error) {
 	return nodeClient, nil
 }
 
-// WaitForNodeReboot waits for a node to reboot and come back online after upgrade
-func (c *Client) WaitForNodeReboot(ctx context.Context, nodeEndpoint string, timeout time.Duration) error {
+// GetNodeBootTime returns the time a node booted at, as reported by the Talos API.
+// Comparing it before and after an upgrade tells whether the node has rebooted.
+func (c *Client) GetNodeBootTime(ctx context.Context, nodeEndpoint string) (uint64, error) {
+	nodeClient, err := c.CreateNodeClient(nodeEndpoint)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create client for node %s: %w", nodeEndpoint, err)
+	}
+	defer nodeClient.Close()
+
+	statResp, err := nodeClient.MachineClient.SystemStat(ctx, &emptypb.Empty{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get system stats from node %s: %w", nodeEndpoint, err)
+	}
+
+	for _, message := range statResp.Messages {
+		if message.BootTime != 0 {
+			return message.BootTime, nil
+		}
+	}
+
+	return 0, fmt.Errorf("node %s did not report a boot time", nodeEndpoint)
+}
+
+// WaitForNodeReboot waits for a node to reboot and come back online after upgrade.
+// The node counts as rebooted once it answers with a boot time other than previousBootTime,
+// a previousBootTime of zero accepts the first answer from the node.
+func (c *Client) WaitForNodeReboot(ctx context.Context, nodeEndpoint string, previousBootTime uint64, timeout time.Duration) error {
 	log.Info().
 		Str("node", nodeEndpoint).
 		Dur("timeout", timeout).
@@ -64,32 +115,29 @@ func (c *Client) WaitForNodeReboot(ctx context.Context, nodeEndpoint string, tim
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Wait a bit for the node to start rebooting
-	time.Sleep(30 * time.Second)
-
-	ticker := time.NewTicker(15 * time.Second)
+	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-timeoutCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("stopped waiting for node %s to come back online: %w", nodeEndpoint, err)
+			}
 			return fmt.Errorf("timeout waiting for node %s to come back online", nodeEndpoint)
 		case <-ticker.C:
-			// Try to connect to the node
-			nodeClient, err := c.CreateNodeClient(nodeEndpoint)
+			// The node answering with a new boot time means it went down and is responsive again
+			statCtx, statCancel := context.WithTimeout(timeoutCtx, 10*time.Second)
+			bootTime, err := c.GetNodeBootTime(statCtx, nodeEndpoint)
+			statCancel()
+
 			if err != nil {
 				log.Debug().Str("node", nodeEndpoint).Err(err).Msg("Node not ready yet")
 				continue
 			}
 
-			// Try to get version to verify the node is responsive
-			versionCtx, versionCancel := context.WithTimeout(ctx, 10*time.Second)
-			_, err = nodeClient.Version(versionCtx)
-			versionCancel()
-			nodeClient.Close()
-
-			if err != nil {
-				log.Debug().Str("node", nodeEndpoint).Err(err).Msg("Node not ready yet")
+			if previousBootTime != 0 && bootTime == previousBootTime {
+				log.Debug().Str("node", nodeEndpoint).Msg("Node has not rebooted yet")
 				continue
 			}
 
@@ -10,10 +10,10 @@ import (
 )
 
 // GetClusterInfo retrieves current cluster information
-func (c *Client) GetClusterInfo() (*ClusterInfo, error) {
+func (c *Client) GetClusterInfo(ctx context.Context) (*ClusterInfo, error) {
 	log.Info().Msg("Retrieving cluster information")
 
-	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	// Get version information
@@ -63,7 +63,7 @@ func (c *Client) GetClusterInfo() (*ClusterInfo, error) {
 		}
 
 		// Get the actual Talos version for this specific node
-		nodeVersion, err := c.getNodeTalosVersion(ctx, endpoint)
+		nodeVersion, err := c.GetNodeTalosVersion(ctx, endpoint)
 		if err != nil {
 			log.Warn().Err(err).Str("node", nodeName).Msg("Failed to get node Talos version, using cluster version")
 			nodeVersion = talosVersion // Fallback to cluster version
@@ -135,8 +135,8 @@ func (c *Client) getNodeEndpoint(ctx context.Context, nodeName string) (string,
 	return k8s.GetNodeEndpoint(ctx, nodeName)
 }
 
-// getNodeTalosVersion gets the Talos version for a specific node
-func (c *Client) getNodeTalosVersion(ctx context.Context, nodeEndpoint string) (string, error) {
+// GetNodeTalosVersion gets the Talos version for a specific node
+func (c *Client) GetNodeTalosVersion(ctx context.Context, nodeEndpoint string) (string, error) {
 	// Create a client for this specific node
 	nodeClient, err := c.CreateNodeClient(nodeEndpoint)
 	if err != nil {
@@ -158,7 +158,7 @@ func (c *Client) getNodeTalosVersion(ctx context.Context, nodeEndpoint string) (
 		if message.Version != nil && message.Version.Tag != "" {
 			log.Debug().
 				Str("endpoint", nodeEndpoint).
-				Str("version", message.Version.Tag).
+				Str("current_version", message.Version.Tag).
 				Msg("Retrieved Talos version from node")
 			return message.Version.Tag, nil
 		}
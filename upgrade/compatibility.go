@@ -0,0 +1,76 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bouquet2/water/talos"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+)
+
+// checkCompatibility verifies that every state the cluster passes through is supported: each Talos hop
+// with the running Kubernetes version, then each Kubernetes step with every Talos version left in the
+// cluster once the Talos upgrade is done, including the versions of nodes held back from it
+func (m *Manager) checkCompatibility(ctx context.Context, clusterInfo *talos.ClusterInfo, selectedNodes []talos.NodeInfo) error {
+	matrix, err := version.LoadCompatibilityMatrix(m.config.Compatibility.OverrideFile)
+	if err != nil {
+		return err
+	}
+
+	var talosPath []string
+	if talosNeedsUpgrade, _ := m.checkTalosUpgradeNeeded(selectedNodes); talosNeedsUpgrade {
+		talosPath, err = m.talosUpgradePath(ctx, selectedNodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, hop := range talosPath {
+		if err := matrix.Check(hop, clusterInfo.K8sVersion); err != nil {
+			return fmt.Errorf("Talos upgrade to %s is not compatible with the running Kubernetes version: %w", hop, err)
+		}
+	}
+
+	// Selected nodes end up on the target, nodes held back keep what they run today
+	talosVersions := []string{m.config.Talos.Version}
+	for _, node := range clusterInfo.Nodes {
+		if !isSelected(node.Name, selectedNodes) && !contains(talosVersions, node.TalosVersion) {
+			talosVersions = append(talosVersions, node.TalosVersion)
+		}
+	}
+
+	k8sPath := []string{clusterInfo.K8sVersion}
+	if k8sNeedsUpgrade, err := version.NeedsUpgrade(clusterInfo.K8sVersion, m.config.K8s.Version); err == nil && k8sNeedsUpgrade {
+		k8sPath, err = m.kubernetesUpgradePath(ctx, clusterInfo.K8sVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, step := range k8sPath {
+		for _, talosVersion := range talosVersions {
+			if err := matrix.Check(talosVersion, step); err != nil {
+				return fmt.Errorf("Kubernetes %s is not compatible with Talos %s: %w", step, talosVersion, err)
+			}
+		}
+	}
+
+	log.Info().
+		Strs("talos_path", talosPath).
+		Strs("k8s_path", k8sPath).
+		Strs("talos_versions", talosVersions).
+		Msg("Talos and Kubernetes versions are compatible throughout the upgrade")
+
+	return nil
+}
+
+// isSelected reports whether a node is among the selected nodes
+func isSelected(nodeName string, selectedNodes []talos.NodeInfo) bool {
+	for _, node := range selectedNodes {
+		if node.Name == nodeName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+)
+
+// KubernetesDryRun runs the upstream Kubernetes upgrade of the next step of the upgrade path with
+// DryRun set and writes the machine configuration and manifest changes it proposes to w, as a diff
+// per node. Later steps build on the changes of earlier ones, so only the next step is previewed.
+func (m *Manager) KubernetesDryRun(ctx context.Context, w io.Writer) error {
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster information: %w", err)
+	}
+
+	k8sNeedsUpgrade, err := version.NeedsUpgrade(clusterInfo.K8sVersion, m.config.K8s.Version)
+	if err != nil {
+		return fmt.Errorf("failed to check Kubernetes version: %w", err)
+	}
+	if !k8sNeedsUpgrade {
+		log.Info().Msg("Kubernetes is already at the target version - nothing to dry run")
+		return nil
+	}
+
+	path, err := m.kubernetesUpgradePath(ctx, clusterInfo.K8sVersion)
+	if err != nil {
+		return err
+	}
+	if len(path) > 1 {
+		log.Info().
+			Strs("path", path).
+			Str("previewed_step", path[0]).
+			Msg("Kubernetes upgrade has several steps, only the first one can be dry run")
+	}
+
+	// The upstream upgrade talks to the control plane through a single endpoint
+	nodeNames := make(map[string]string)
+	var controlPlaneEndpoint string
+	for _, node := range clusterInfo.Nodes {
+		nodeNames[node.Endpoint] = node.Name
+		if node.IsControlPlane && controlPlaneEndpoint == "" {
+			controlPlaneEndpoint = node.Endpoint
+		}
+	}
+	if controlPlaneEndpoint == "" {
+		return fmt.Errorf("no control plane nodes found in cluster")
+	}
+
+	dryRunCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	result, err := k8s.DryRunKubernetesUpgrade(dryRunCtx, m.talosClient.GetClient(), m.talosClient.GetConfig(), controlPlaneEndpoint, path[0])
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Int("nodes", len(result.Nodes)).
+		Int("manifest_lines", len(result.Manifests)).
+		Msg("Kubernetes dry run completed")
+
+	return result.WriteDiff(w, nodeNames)
+}
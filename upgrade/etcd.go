@@ -0,0 +1,128 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bouquet2/water/talos"
+	"github.com/rs/zerolog/log"
+)
+
+// controlPlaneEndpoints maps control plane node names to their Talos endpoints
+func controlPlaneEndpoints(allNodes []talos.NodeInfo) map[string]string {
+	endpoints := make(map[string]string)
+	for _, node := range allNodes {
+		if node.IsControlPlane {
+			endpoints[node.Name] = node.Endpoint
+		}
+	}
+	return endpoints
+}
+
+// checkEtcdBeforeNode refuses to take a control plane node down while etcd has unhealthy members,
+// active alarms, or too few healthy voters to keep quorum without it
+func (m *Manager) checkEtcdBeforeNode(ctx context.Context, nodeName string, allNodes []talos.NodeInfo) error {
+	health, err := m.talosClient.GetEtcdHealth(ctx, controlPlaneEndpoints(allNodes))
+	if err != nil {
+		return fmt.Errorf("%w: failed to check etcd health: %w", errStopRollout, err)
+	}
+
+	if err := etcdProblems(health); err != nil {
+		return fmt.Errorf("%w: etcd is not healthy before upgrading %s: %w", errStopRollout, nodeName, err)
+	}
+
+	if err := m.checkEtcdQuorum(nodeName, health); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("node", nodeName).
+		Int("healthy_voters", health.HealthyVoters()).
+		Int("quorum", health.Quorum()).
+		Msg("etcd is healthy, proceeding with control plane node")
+
+	return nil
+}
+
+// checkEtcdQuorum refuses to take nodeName down if the remaining healthy voters would fall below quorum.
+// A single voter cannot keep quorum without itself, so single control plane clusters are only warned about.
+func (m *Manager) checkEtcdQuorum(nodeName string, health *talos.EtcdHealth) error {
+	// The node going down removes one healthy voter, unless it is a learner
+	remainingVoters := health.HealthyVoters()
+	for _, member := range health.Members {
+		if member.Hostname == nodeName && !member.IsLearner {
+			remainingVoters--
+		}
+	}
+
+	if remainingVoters >= health.Quorum() {
+		return nil
+	}
+
+	switch {
+	case health.Voters() == 1:
+		log.Warn().
+			Str("node", nodeName).
+			Msg("etcd has a single voter and is unavailable while this node upgrades")
+	case m.config.Etcd.AllowQuorumLoss:
+		log.Warn().
+			Str("node", nodeName).
+			Int("remaining_voters", remainingVoters).
+			Int("quorum", health.Quorum()).
+			Msg("etcd will lose quorum while this node upgrades, allowed by etcd.allowQuorumLoss")
+	default:
+		return fmt.Errorf("%w: upgrading %s would leave %d of %d etcd voters, below quorum of %d (set etcd.allowQuorumLoss to accept this)",
+			errStopRollout, nodeName, remainingVoters, health.Voters(), health.Quorum())
+	}
+
+	return nil
+}
+
+// waitForEtcdAfterNode waits for every etcd member, including the one on the upgraded node, to be healthy again
+func (m *Manager) waitForEtcdAfterNode(ctx context.Context, nodeName string, allNodes []talos.NodeInfo) error {
+	log.Info().
+		Str("node", nodeName).
+		Dur("timeout", m.config.Etcd.HealthTimeout).
+		Msg("Waiting for etcd to become healthy after control plane node upgrade")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, m.config.Etcd.HealthTimeout)
+	defer cancel()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		health, err := m.talosClient.GetEtcdHealth(timeoutCtx, controlPlaneEndpoints(allNodes))
+		if err == nil {
+			err = etcdProblems(health)
+		}
+		if err == nil {
+			log.Info().Str("node", nodeName).Msg("etcd is healthy")
+			return nil
+		}
+
+		lastErr = err
+		log.Debug().Err(err).Str("node", nodeName).Msg("etcd not healthy yet")
+
+		select {
+		case <-timeoutCtx.Done():
+			return fmt.Errorf("%w: etcd did not become healthy after upgrading %s: %w", errStopRollout, nodeName, lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+// etcdProblems returns an error describing unhealthy members and active alarms, or nil if there are none
+func etcdProblems(health *talos.EtcdHealth) error {
+	if len(health.Alarms) > 0 {
+		return fmt.Errorf("active etcd alarms: %v", health.Alarms)
+	}
+
+	if unhealthy := health.UnhealthyMembers(); len(unhealthy) > 0 {
+		return fmt.Errorf("unhealthy etcd members: %v", unhealthy)
+	}
+
+	return nil
+}
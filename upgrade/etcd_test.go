@@ -0,0 +1,62 @@
+package upgrade
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/talos"
+)
+
+// etcdMembers returns a healthy etcd with a voter for each of the given hostnames
+func etcdMembers(hostnames ...string) *talos.EtcdHealth {
+	health := &talos.EtcdHealth{}
+	for i, hostname := range hostnames {
+		health.Members = append(health.Members, talos.EtcdMemberHealth{ID: uint64(i + 1), Hostname: hostname, Healthy: true})
+	}
+	return health
+}
+
+func TestCheckEtcdQuorum(t *testing.T) {
+	threeVoters := etcdMembers("cp-1", "cp-2", "cp-3")
+
+	oneUnhealthy := etcdMembers("cp-1", "cp-2", "cp-3")
+	oneUnhealthy.Members[1].Healthy = false
+
+	withLearner := etcdMembers("cp-1", "cp-2", "cp-3")
+	withLearner.Members = append(withLearner.Members, talos.EtcdMemberHealth{ID: 4, Hostname: "cp-4", IsLearner: true, Healthy: true})
+
+	twoVoters := etcdMembers("cp-1", "cp-2")
+
+	tests := []struct {
+		name            string
+		health          *talos.EtcdHealth
+		node            string
+		allowQuorumLoss bool
+		wantErr         bool
+	}{
+		{"single voter", etcdMembers("cp-1"), "cp-1", false, false},
+		{"single voter with quorum loss allowed", etcdMembers("cp-1"), "cp-1", true, false},
+		{"three voters", threeVoters, "cp-1", false, false},
+		{"three voters with one unhealthy", oneUnhealthy, "cp-1", false, true},
+		{"three voters with one unhealthy and quorum loss allowed", oneUnhealthy, "cp-1", true, false},
+		{"three voters, node is not a member", oneUnhealthy, "worker-1", false, false},
+		{"learner does not count as voter", withLearner, "cp-4", false, false},
+		{"two voters", twoVoters, "cp-1", false, true},
+		{"two voters with quorum loss allowed", twoVoters, "cp-1", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{config: &config.Config{Etcd: config.EtcdConfig{AllowQuorumLoss: tt.allowQuorumLoss}}}
+
+			err := m.checkEtcdQuorum(tt.node, tt.health)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkEtcdQuorum(%s) error = %v, want error: %t", tt.node, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errStopRollout) {
+				t.Errorf("checkEtcdQuorum(%s) error = %v, want it to stop the rollout", tt.node, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package upgrade
+
+import (
+	"context"
+	"time"
+
+	"github.com/bouquet2/water/talos"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+)
+
+// EventType identifies what an Event reports
+type EventType string
+
+const (
+	// EventStarted reports the start of an upgrade run, with the plan it executes
+	EventStarted EventType = "started"
+	// EventPhaseStarted reports the start of a Talos hop or Kubernetes step
+	EventPhaseStarted EventType = "phase-started"
+	// EventNode reports a node state transition within a phase
+	EventNode EventType = "node"
+	// EventCompleted reports the end of an upgrade run, with its result
+	EventCompleted EventType = "completed"
+	// EventNodeVersions reports the versions every node runs, after a check and after an upgrade run
+	EventNodeVersions EventType = "node-versions"
+)
+
+// Event is a progress update of an upgrade run. Only the fields relevant to its type are set.
+type Event struct {
+	Type          EventType
+	Time          time.Time
+	Phase         Phase
+	TargetVersion string
+	Node          string
+	State         NodeState
+	Err           error
+	Plan          *Plan
+	Result        *UpgradeResult
+	Nodes         []NodeVersions
+}
+
+// NodeVersions holds the versions a node runs and whether they match the configured targets
+type NodeVersions struct {
+	Name           string
+	ControlPlane   bool
+	TalosVersion   string
+	KubeletVersion string
+	UpToDate       bool
+}
+
+// EventHandler receives upgrade events. Nodes of a batch upgrade in parallel, so handlers
+// may be called concurrently and must not block the upgrade for long.
+type EventHandler func(Event)
+
+// AddEventHandler registers a handler that receives every upgrade event of the manager
+func (m *Manager) AddEventHandler(handler EventHandler) {
+	m.handlersMu.Lock()
+	defer m.handlersMu.Unlock()
+
+	m.handlers = append(m.handlers, handler)
+}
+
+// emit passes an event to every registered handler
+func (m *Manager) emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	m.handlersMu.RLock()
+	handlers := append([]EventHandler(nil), m.handlers...)
+	m.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// emitNodeVersions reports the versions the given nodes run. The kubelet versions are only
+// looked up when a handler is registered to receive them.
+func (m *Manager) emitNodeVersions(ctx context.Context, nodes []talos.NodeInfo) {
+	m.handlersMu.RLock()
+	hasHandlers := len(m.handlers) > 0
+	m.handlersMu.RUnlock()
+	if !hasHandlers {
+		return
+	}
+
+	kubeletVersions := m.kubeletVersions(ctx)
+
+	event := Event{Type: EventNodeVersions}
+	for _, node := range nodes {
+		nodeVersions := NodeVersions{
+			Name:           node.Name,
+			ControlPlane:   node.IsControlPlane,
+			TalosVersion:   node.TalosVersion,
+			KubeletVersion: kubeletVersions[node.Name],
+		}
+
+		talosNeedsUpgrade, talosErr := version.NeedsUpgrade(nodeVersions.TalosVersion, m.config.Talos.Version)
+		k8sNeedsUpgrade, k8sErr := version.NeedsUpgrade(nodeVersions.KubeletVersion, m.config.K8s.Version)
+		if talosErr != nil || k8sErr != nil {
+			log.Debug().Str("node", node.Name).Msg("Could not compare node versions with the targets")
+		}
+		nodeVersions.UpToDate = talosErr == nil && k8sErr == nil && !talosNeedsUpgrade && !k8sNeedsUpgrade
+
+		event.Nodes = append(event.Nodes, nodeVersions)
+	}
+
+	m.emit(event)
+}
+
+// setPhase records the start of a new phase in the journal and reports it to the event handlers
+func (m *Manager) setPhase(phase Phase, targetVersion string) {
+	m.journal.SetPhase(phase, targetVersion)
+	m.emit(Event{Type: EventPhaseStarted, Phase: phase, TargetVersion: targetVersion})
+}
+
+// recordNode records a node state transition in the journal and reports it to the event handlers
+func (m *Manager) recordNode(phase Phase, targetVersion, nodeName string, state NodeState, nodeErr error) {
+	m.journal.RecordNode(phase, targetVersion, nodeName, state, nodeErr)
+	logNodeState(phase, targetVersion, nodeName, state, nodeErr)
+	m.emit(Event{Type: EventNode, Phase: phase, TargetVersion: targetVersion, Node: nodeName, State: state, Err: nodeErr})
+}
+
+// recordUpgradeInitiated records that a node accepted its upgrade in the journal and reports it to the event handlers
+func (m *Manager) recordUpgradeInitiated(phase Phase, targetVersion, nodeName string, bootTime uint64) {
+	m.journal.RecordUpgradeInitiated(phase, targetVersion, nodeName, bootTime)
+	logNodeState(phase, targetVersion, nodeName, NodeUpgradeInitiated, nil)
+	m.emit(Event{Type: EventNode, Phase: phase, TargetVersion: targetVersion, Node: nodeName, State: NodeUpgradeInitiated})
+}
+
+// logNodeState logs a node state transition with the fields log pipelines index upgrade runs by
+func logNodeState(phase Phase, targetVersion, nodeName string, state NodeState, nodeErr error) {
+	event := log.Info()
+	if nodeErr != nil {
+		event = log.Warn().Err(nodeErr)
+	}
+	event.
+		Str("node", nodeName).
+		Str("phase", string(phase)).
+		Str("target_version", targetVersion).
+		Str("state", string(state)).
+		Msg("Node upgrade state changed")
+}
@@ -0,0 +1,107 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/factory"
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/talos"
+	"github.com/rs/zerolog/log"
+)
+
+// installerImages returns the installer image, without version tag, of every node: the first
+// talos.imageOverrides entry that matches the node, or the default installer image if none does
+func (m *Manager) installerImages(ctx context.Context, nodes []talos.NodeInfo) (map[string]string, error) {
+	image, err := m.defaultImage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		images[node.Name] = image
+	}
+
+	overrides := m.config.Talos.ImageOverrides
+	if len(overrides) == 0 {
+		return images, nil
+	}
+
+	// Labels and architectures only live in Kubernetes, so fetch them once for all nodes
+	kubeClusterInfo, err := k8s.GetClusterInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node labels and architectures: %w", err)
+	}
+
+	kubeNodes := make(map[string]k8s.NodeInfo)
+	for _, node := range kubeClusterInfo.Nodes {
+		kubeNodes[node.Name] = node
+	}
+
+	// Without its Kubernetes node the labels and architecture of a node are unknown, and falling back
+	// to the default image could install an image of the wrong architecture
+	needsKubeNode := slices.ContainsFunc(overrides, func(override config.ImageOverride) bool {
+		return override.Architecture != "" || override.Labels != ""
+	})
+
+	for _, node := range nodes {
+		kubeNode, known := kubeNodes[node.Name]
+		if !known && needsKubeNode {
+			return nil, fmt.Errorf("node %s is not known to Kubernetes, its labels and architecture cannot be matched against talos.imageOverrides", node.Name)
+		}
+
+		for i, override := range overrides {
+			matched, err := overrideMatches(override, node.Name, kubeNode)
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate talos.imageOverrides[%d]: %w", i, err)
+			}
+			if !matched {
+				continue
+			}
+
+			log.Debug().
+				Str("node", node.Name).
+				Str("image", override.ImageID).
+				Int("override", i).
+				Msg("Installer image overridden for node")
+			images[node.Name] = override.ImageID
+			break
+		}
+	}
+
+	return images, nil
+}
+
+// overrideMatches reports whether a node matches the architecture, label selector and name patterns of an override
+func overrideMatches(override config.ImageOverride, nodeName string, kubeNode k8s.NodeInfo) (bool, error) {
+	if override.Architecture != "" && override.Architecture != kubeNode.Architecture {
+		return false, nil
+	}
+	return matchesSelector(override.NodeSelector, nodeName, kubeNode.Labels)
+}
+
+// defaultImage returns the installer image, without version tag, of talos.imageId or of the schematic
+// declared in talos.schematic
+func (m *Manager) defaultImage(ctx context.Context) (string, error) {
+	if m.factory == nil {
+		return m.config.Talos.ImageID, nil
+	}
+
+	id, err := m.schematicID(ctx)
+	if err != nil {
+		return "", err
+	}
+	return m.factory.InstallerImage(id), nil
+}
+
+// schematicID returns the ID the Image Factory gives the schematic declared in talos.schematic
+func (m *Manager) schematicID(ctx context.Context) (string, error) {
+	id, err := m.factory.SchematicID(ctx, factory.SchematicFromConfig(m.config.Talos.Schematic))
+	if err != nil {
+		return "", fmt.Errorf("failed to get schematic ID of talos.schematic: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,322 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/rs/zerolog/log"
+)
+
+// Phase identifies a stage of the upgrade process recorded in the journal
+type Phase string
+
+const (
+	// PhasePrerequisites is the validation stage before any node is touched
+	PhasePrerequisites Phase = "prerequisites"
+	// PhaseTalos is the Talos OS rolling upgrade
+	PhaseTalos Phase = "talos"
+	// PhaseKubernetes is the Kubernetes rolling upgrade
+	PhaseKubernetes Phase = "kubernetes"
+	// PhaseCompleted marks a run that finished, with or without errors
+	PhaseCompleted Phase = "completed"
+)
+
+// NodeState is the last known state of a node within a phase
+type NodeState string
+
+const (
+	// NodePending means the node has not been touched in this phase yet
+	NodePending NodeState = ""
+	// NodeStarted means work on the node has begun but nothing was sent to it yet
+	NodeStarted NodeState = "started"
+	// NodeUpgradeInitiated means the upgrade request was accepted by the node
+	NodeUpgradeInitiated NodeState = "upgrade-initiated"
+	// NodeCompleted means the node finished the phase successfully
+	NodeCompleted NodeState = "completed"
+	// NodeFailed means the node failed the phase
+	NodeFailed NodeState = "failed"
+	// NodeRolledBack means the node failed the phase and was returned to its previous version
+	NodeRolledBack NodeState = "rolled-back"
+	// NodeAborted means work on the node was cut short because the run was aborted
+	NodeAborted NodeState = "aborted"
+)
+
+// JournalEntry is a single recorded transition
+type JournalEntry struct {
+	Time          time.Time `json:"time"`
+	Phase         Phase     `json:"phase"`
+	TargetVersion string    `json:"targetVersion,omitempty"`
+	Node          string    `json:"node,omitempty"`
+	State         NodeState `json:"state,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	// BootTime is the node's boot time before its upgrade was initiated, used to detect the reboot on resume
+	BootTime uint64 `json:"bootTime,omitempty"`
+}
+
+// Journal is a durable record of upgrade progress that allows an interrupted
+// run to be resumed at the node and phase where it stopped
+type Journal struct {
+	mu          sync.Mutex
+	path        string
+	resumePhase Phase
+
+	StartedAt   time.Time      `json:"startedAt"`
+	UpdatedAt   time.Time      `json:"updatedAt"`
+	TalosTarget string         `json:"talosTarget"`
+	K8sTarget   string         `json:"k8sTarget"`
+	Phase       Phase          `json:"phase"`
+	Entries     []JournalEntry `json:"entries"`
+}
+
+// OpenJournal creates a new journal at path, or loads the existing one when resume is set.
+// A resumed journal must have been written for the same target versions as cfg.
+func OpenJournal(path string, resume bool, cfg *config.Config) (*Journal, error) {
+	if !resume {
+		if existing, err := loadJournal(path); err == nil && existing.Phase != PhaseCompleted {
+			log.Warn().
+				Str("journal", path).
+				Str("phase", string(existing.Phase)).
+				Time("updated_at", existing.UpdatedAt).
+				Msg("Previous upgrade run did not complete - starting a new journal (use --resume to continue it)")
+		}
+
+		now := time.Now()
+		j := &Journal{
+			path:        path,
+			StartedAt:   now,
+			UpdatedAt:   now,
+			TalosTarget: cfg.Talos.Version,
+			K8sTarget:   cfg.K8s.Version,
+			Phase:       PhasePrerequisites,
+			Entries:     make([]JournalEntry, 0),
+		}
+		if err := j.save(); err != nil {
+			return nil, err
+		}
+
+		log.Info().Str("journal", path).Msg("Upgrade journal created")
+		return j, nil
+	}
+
+	j, err := loadJournal(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load journal for resume: %w", err)
+	}
+
+	if j.TalosTarget != cfg.Talos.Version || j.K8sTarget != cfg.K8s.Version {
+		return nil, fmt.Errorf("journal %s was written for Talos %s / Kubernetes %s, but configuration targets Talos %s / Kubernetes %s",
+			path, j.TalosTarget, j.K8sTarget, cfg.Talos.Version, cfg.K8s.Version)
+	}
+
+	log.Info().
+		Str("journal", path).
+		Str("phase", string(j.Phase)).
+		Int("entries", len(j.Entries)).
+		Time("started_at", j.StartedAt).
+		Msg("Resuming upgrade from journal")
+
+	return j, nil
+}
+
+// CanResumeJournal reports whether the journal at path belongs to an unfinished run
+// with the same target versions as cfg, so that OpenJournal can resume it
+func CanResumeJournal(path string, cfg *config.Config) bool {
+	j, err := loadJournal(path)
+	if err != nil {
+		return false
+	}
+	return j.Phase != PhaseCompleted && j.TalosTarget == cfg.Talos.Version && j.K8sTarget == cfg.K8s.Version
+}
+
+// loadJournal reads a journal from disk
+func loadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("failed to decode journal %s: %w", path, err)
+	}
+	j.path = path
+	j.resumePhase = j.Phase
+
+	return &j, nil
+}
+
+// save writes the journal atomically by replacing the file with a fully written copy.
+// Callers must hold j.mu or have exclusive access to the journal.
+func (j *Journal) save() error {
+	if err := os.MkdirAll(filepath.Dir(j.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+
+	tmpPath := j.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return fmt.Errorf("failed to replace journal: %w", err)
+	}
+
+	return nil
+}
+
+// append adds an entry and persists the journal, logging instead of failing on write errors
+// so that a full disk never aborts an upgrade that is already in flight
+func (j *Journal) append(entry JournalEntry) {
+	entry.Time = time.Now()
+	j.Entries = append(j.Entries, entry)
+	j.UpdatedAt = entry.Time
+
+	if err := j.save(); err != nil {
+		log.Error().Err(err).Str("journal", j.path).Msg("Failed to persist upgrade journal")
+	}
+}
+
+// SetPhase records the start of a new phase
+func (j *Journal) SetPhase(phase Phase, targetVersion string) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.Phase = phase
+	j.append(JournalEntry{Phase: phase, TargetVersion: targetVersion})
+}
+
+// RecordNode records a node state transition within a phase
+func (j *Journal) RecordNode(phase Phase, targetVersion, nodeName string, state NodeState, nodeErr error) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry := JournalEntry{
+		Phase:         phase,
+		TargetVersion: targetVersion,
+		Node:          nodeName,
+		State:         state,
+	}
+	if nodeErr != nil {
+		entry.Error = nodeErr.Error()
+	}
+
+	j.append(entry)
+}
+
+// RecordUpgradeInitiated records that a node accepted its upgrade, together with the boot time
+// it had before, so a resumed run can still tell whether the node has rebooted since
+func (j *Journal) RecordUpgradeInitiated(phase Phase, targetVersion, nodeName string, bootTime uint64) {
+	if j == nil {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.append(JournalEntry{
+		Phase:         phase,
+		TargetVersion: targetVersion,
+		Node:          nodeName,
+		State:         NodeUpgradeInitiated,
+		BootTime:      bootTime,
+	})
+}
+
+// NodeBootTime returns the boot time recorded when the node's upgrade was initiated, or zero if unknown
+func (j *Journal) NodeBootTime(phase Phase, targetVersion, nodeName string) uint64 {
+	if j == nil {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		entry := j.Entries[i]
+		if entry.Phase == phase && entry.TargetVersion == targetVersion && entry.Node == nodeName && entry.State == NodeUpgradeInitiated {
+			return entry.BootTime
+		}
+	}
+
+	return 0
+}
+
+// NodeState returns the last recorded state of a node for a phase and target version. Aborts are
+// passed over, so that a resumed run continues from the state the node had reached.
+func (j *Journal) NodeState(phase Phase, targetVersion, nodeName string) NodeState {
+	if j == nil {
+		return NodePending
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for i := len(j.Entries) - 1; i >= 0; i-- {
+		entry := j.Entries[i]
+		if entry.Phase == phase && entry.TargetVersion == targetVersion && entry.Node == nodeName && entry.State != "" && entry.State != NodeAborted {
+			return entry.State
+		}
+	}
+
+	return NodePending
+}
+
+// NodeAttempts returns how often work on a node was started for a phase and target version,
+// counting the runs the journal was resumed from
+func (j *Journal) NodeAttempts(phase Phase, targetVersion, nodeName string) int {
+	if j == nil {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var attempts int
+	for _, entry := range j.Entries {
+		if entry.Phase == phase && entry.TargetVersion == targetVersion && entry.Node == nodeName && entry.State == NodeStarted {
+			attempts++
+		}
+	}
+
+	return attempts
+}
+
+// Complete marks the run as finished
+func (j *Journal) Complete() {
+	j.SetPhase(PhaseCompleted, "")
+}
+
+// ResumePhase returns the phase an interrupted run had reached when the journal
+// was loaded with resume, or an empty phase for a fresh journal
+func (j *Journal) ResumePhase() Phase {
+	if j == nil {
+		return ""
+	}
+	return j.resumePhase
+}
+
+// Path returns the file the journal is written to
+func (j *Journal) Path() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
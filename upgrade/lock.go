@@ -0,0 +1,81 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/bouquet2/water/k8s"
+	"github.com/rs/zerolog/log"
+)
+
+// lockTimeout bounds taking and releasing the upgrade lock
+const lockTimeout = 30 * time.Second
+
+// errLockLost marks a run that stopped because someone else took over the upgrade lock
+var errLockLost = errors.New("upgrade lock was taken over by someone else")
+
+// SetBreakLock makes the next upgrade take over the upgrade lock even if another holder is still renewing it
+func (m *Manager) SetBreakLock(breakLock bool) {
+	m.breakLock = breakLock
+}
+
+// acquireLock takes the Lease that keeps two upgrades from running against the cluster at the same time
+func (m *Manager) acquireLock(ctx context.Context) (*k8s.Lease, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, lockTimeout)
+	defer cancel()
+
+	lease, err := k8s.AcquireLease(lockCtx, m.config.Lock.Namespace, m.config.Lock.Name, lockHolder(), m.config.Lock.Duration, m.breakLock)
+	if err != nil {
+		var heldErr *k8s.LeaseHeldError
+		if errors.As(err, &heldErr) {
+			return nil, fmt.Errorf("another upgrade is running: %w", err)
+		}
+		return nil, fmt.Errorf("failed to take upgrade lock: %w", err)
+	}
+
+	return lease, nil
+}
+
+// checkLock refuses to start further nodes once the upgrade lock held by the run was taken over
+func (m *Manager) checkLock() error {
+	if m.lease == nil {
+		return nil
+	}
+
+	select {
+	case <-m.lease.Lost():
+		return errLockLost
+	default:
+		return nil
+	}
+}
+
+// releaseLock gives up the upgrade lock, logging instead of failing since the upgrade itself already finished.
+// The lock is released even when ctx was cancelled, so that an aborted run does not block the next one.
+func (m *Manager) releaseLock(ctx context.Context, lease *k8s.Lease) {
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockTimeout)
+	defer cancel()
+
+	if err := lease.Release(releaseCtx); err != nil {
+		log.Error().Err(err).Msg("Failed to release upgrade lock, it expires on its own")
+	}
+}
+
+// lockHolder identifies this process in the upgrade lock, so that whoever is refused knows who to ask
+func lockHolder() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown-host"
+	}
+
+	username := "unknown-user"
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	return fmt.Sprintf("%s@%s (pid %d)", username, hostname, os.Getpid())
+}
@@ -0,0 +1,91 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errOutsideMaintenanceWindow marks upgrades refused or stopped to stay inside the maintenance windows
+var errOutsideMaintenanceWindow = errors.New("outside maintenance window")
+
+// checkMaintenanceWindow refuses to start an upgrade outside the configured maintenance windows
+func (m *Manager) checkMaintenanceWindow() error {
+	if !m.config.Maintenance.Enabled() {
+		return nil
+	}
+
+	now := time.Now()
+	windowEnd, open := m.config.Maintenance.WindowEnd(now)
+	if !open {
+		if next, found := m.config.Maintenance.NextWindowStart(now); found {
+			return fmt.Errorf("%w: the next window opens at %s", errOutsideMaintenanceWindow, next.Format(time.RFC3339))
+		}
+		return fmt.Errorf("%w: no window opens within the next two weeks", errOutsideMaintenanceWindow)
+	}
+
+	log.Info().
+		Time("window_end", windowEnd).
+		Dur("remaining", time.Until(windowEnd).Round(time.Second)).
+		Msg("Inside maintenance window")
+
+	return nil
+}
+
+// checkWindowBeforeNodes stops the rollout before the next nodes start if the maintenance window would
+// close before they are estimated to finish. Nodes of a batch run in parallel and take one node duration.
+func (m *Manager) checkWindowBeforeNodes(phase Phase, nodeNames []string) error {
+	if !m.config.Maintenance.Enabled() {
+		return nil
+	}
+
+	now := time.Now()
+	estimate := m.estimatedNodeDuration(phase)
+	windowEnd, open := m.config.Maintenance.WindowEnd(now)
+	if open && !now.Add(estimate).After(windowEnd) {
+		return nil
+	}
+
+	log.Warn().
+		Strs("nodes", nodeNames).
+		Time("window_end", windowEnd).
+		Dur("estimated_duration", estimate).
+		Msg("Maintenance window closes before the next nodes would finish, stopping the rollout")
+
+	return fmt.Errorf("%w: %w: not enough time left in the maintenance window to upgrade %v (estimated %s)",
+		errStopRollout, errOutsideMaintenanceWindow, nodeNames, estimate)
+}
+
+// recordNodeDuration remembers how long a node of the given phase took to upgrade
+func (m *Manager) recordNodeDuration(phase Phase, duration time.Duration) {
+	m.durationsMu.Lock()
+	defer m.durationsMu.Unlock()
+
+	if m.nodeDurations == nil {
+		m.nodeDurations = make(map[Phase][]time.Duration)
+	}
+	m.nodeDurations[phase] = append(m.nodeDurations[phase], duration)
+}
+
+// estimatedNodeDuration returns how long the next node of the given phase is expected to take:
+// maintenance.nodeDuration, or the average of the nodes upgraded so far in this phase if that is longer
+func (m *Manager) estimatedNodeDuration(phase Phase) time.Duration {
+	m.durationsMu.Lock()
+	defer m.durationsMu.Unlock()
+
+	estimate := m.config.Maintenance.NodeDuration
+
+	durations := m.nodeDurations[phase]
+	if len(durations) == 0 {
+		return estimate
+	}
+
+	var total time.Duration
+	for _, duration := range durations {
+		total += duration
+	}
+
+	return max(estimate, total/time.Duration(len(durations)))
+}
@@ -2,40 +2,85 @@ package upgrade
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"sync"
 	"time"
 
 	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/factory"
 	"github.com/bouquet2/water/k8s"
 	"github.com/bouquet2/water/talos"
 	"github.com/bouquet2/water/version"
 	"github.com/rs/zerolog/log"
-    "strings"
+	"sigs.k8s.io/yaml"
+	"strings"
 )
 
 // Manager handles the upgrade process for Talos and Kubernetes
 type Manager struct {
 	talosClient *talos.Client
 	config      *config.Config
+	journal     *Journal
+	breakLock   bool
+	// lease is the upgrade lock held while a plan is executed
+	lease *k8s.Lease
+	// factory registers talos.schematic, nil when the installer image is given as talos.imageId
+	factory *factory.Client
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	durationsMu   sync.Mutex
+	nodeDurations map[Phase][]time.Duration
+
+	handlersMu sync.RWMutex
+	handlers   []EventHandler
 }
 
 // NewManager creates a new upgrade manager
 func NewManager(talosClient *talos.Client, cfg *config.Config) *Manager {
-	return &Manager{
+	m := &Manager{
 		talosClient: talosClient,
 		config:      cfg,
+		stop:        make(chan struct{}),
 	}
+	if schematic := cfg.Talos.Schematic; !schematic.IsEmpty() {
+		m.factory = factory.NewClient(schematic.FactoryURL, schematic.CachePath)
+	}
+	return m
+}
+
+// SetJournal attaches a journal that records every phase and node transition.
+// When the journal was opened for resume, nodes it already completed are skipped.
+func (m *Manager) SetJournal(journal *Journal) {
+	m.journal = journal
 }
 
 // UpgradeResult represents the result of an upgrade operation
 type UpgradeResult struct {
+	mu sync.Mutex
+
 	TalosUpgraded    bool
 	K8sUpgraded      bool
 	Errors           []error
 	NodesUpgraded    []string
 	FailedNodes      []string
+	SkippedNodes     []SkippedNode
+	Rollbacks        []RollbackRecord
 	RollbackRequired bool
 	UpgradeDuration  time.Duration
+	// Interrupted means the run was stopped or aborted before all of its nodes were upgraded
+	Interrupted bool
+
+	// StartedAt, Talos and Kubernetes describe the run for its report
+	StartedAt  time.Time
+	Talos      PlanVersions
+	Kubernetes PlanVersions
+	// Nodes holds a record for every node worked on, in the order the work started
+	Nodes []NodeRecord
 }
 
 // String returns a string representation of the upgrade result
@@ -55,6 +100,9 @@ func (r *UpgradeResult) HasErrors() bool {
 
 // AddUpgradedNode adds a node to the list of successfully upgraded nodes
 func (r *UpgradeResult) AddUpgradedNode(nodeName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if !contains(r.NodesUpgraded, nodeName) {
 		r.NodesUpgraded = append(r.NodesUpgraded, nodeName)
 	}
@@ -62,12 +110,23 @@ func (r *UpgradeResult) AddUpgradedNode(nodeName string) {
 
 // AddFailedNode adds a node to the list of failed nodes
 func (r *UpgradeResult) AddFailedNode(nodeName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if !contains(r.FailedNodes, nodeName) {
 		r.FailedNodes = append(r.FailedNodes, nodeName)
 	}
 	r.RollbackRequired = true
 }
 
+// AddError records an error that occurred during the upgrade
+func (r *UpgradeResult) AddError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Errors = append(r.Errors, err)
+}
+
 // GetSuccessRate returns the success rate of the upgrade
 func (r *UpgradeResult) GetSuccessRate() float64 {
 	total := len(r.NodesUpgraded) + len(r.FailedNodes)
@@ -77,8 +136,54 @@ func (r *UpgradeResult) GetSuccessRate() float64 {
 	return float64(len(r.NodesUpgraded)) / float64(total)
 }
 
-// PerformUpgrade performs the complete upgrade process
-func (m *Manager) PerformUpgrade() (*UpgradeResult, error) {
+// PerformUpgrade performs the complete upgrade process. Cancelling ctx aborts the nodes in progress,
+// Stop lets them finish first.
+func (m *Manager) PerformUpgrade(ctx context.Context) (*UpgradeResult, error) {
+	plan, err := m.BuildPlan(ctx)
+	if err != nil {
+		return m.failRun(fmt.Errorf("failed to build upgrade plan: %w", err))
+	}
+
+	return m.ExecutePlan(ctx, plan)
+}
+
+// ExecutePlan runs the steps of an upgrade plan in order. Nodes that already run the version of a step
+// are left alone, so a plan can be executed again after an interrupted run. The steps, waves, nodes and
+// images come from the plan, the waits and node selection from the configuration, which must still match
+// the plan. The upgrade lock is held for the whole run.
+func (m *Manager) ExecutePlan(ctx context.Context, plan *Plan) (*UpgradeResult, error) {
+	lease, err := m.acquireLock(ctx)
+	if err != nil {
+		return m.failRun(err)
+	}
+	m.lease = lease
+	defer func() {
+		m.releaseLock(ctx, lease)
+		m.lease = nil
+	}()
+
+	m.emit(Event{Type: EventStarted, Plan: plan})
+
+	result, err := m.executePlan(ctx, plan)
+	m.emit(Event{Type: EventCompleted, Result: result, Err: err})
+
+	return result, err
+}
+
+// failRun reports a run that failed before it started
+func (m *Manager) failRun(err error) (*UpgradeResult, error) {
+	result := &UpgradeResult{
+		NodesUpgraded: make([]string, 0),
+		FailedNodes:   make([]string, 0),
+		Errors:        []error{err},
+		StartedAt:     time.Now(),
+	}
+	m.emit(Event{Type: EventCompleted, Result: result, Err: err})
+	return result, err
+}
+
+// executePlan runs the steps of an upgrade plan and reports the result
+func (m *Manager) executePlan(ctx context.Context, plan *Plan) (*UpgradeResult, error) {
 	log.Info().Msg("Starting upgrade process")
 	startTime := time.Now()
 
@@ -86,106 +191,112 @@ func (m *Manager) PerformUpgrade() (*UpgradeResult, error) {
 		NodesUpgraded: make([]string, 0),
 		FailedNodes:   make([]string, 0),
 		Errors:        make([]error, 0),
+		StartedAt:     startTime,
+		Talos:         plan.Talos,
+		Kubernetes:    plan.Kubernetes,
 	}
 
 	// Validate prerequisites before starting upgrade
-	if err := m.validateUpgradePrerequisites(); err != nil {
+	if err := m.validateUpgradePrerequisites(ctx); err != nil {
 		result.Errors = append(result.Errors, fmt.Errorf("upgrade prerequisites validation failed: %w", err))
 		return result, fmt.Errorf("upgrade prerequisites validation failed: %w", err)
 	}
 
-	// Get current cluster information
-	clusterInfo, err := m.talosClient.GetClusterInfo()
-	if err != nil {
-		result.Errors = append(result.Errors, fmt.Errorf("failed to get cluster information: %w", err))
-		return result, fmt.Errorf("failed to get cluster information: %w", err)
+	// A plan made for other target versions must not be run against this configuration
+	if plan.Talos.Target != m.config.Talos.Version || plan.Kubernetes.Target != m.config.K8s.Version {
+		err := fmt.Errorf("plan targets Talos %s and Kubernetes %s, but the configuration targets Talos %s and Kubernetes %s",
+			plan.Talos.Target, plan.Kubernetes.Target, m.config.Talos.Version, m.config.K8s.Version)
+		result.Errors = append(result.Errors, err)
+		return result, err
 	}
+	result.SkippedNodes = plan.SkippedNodes
 
-	log.Info().
-		Str("current_talos", clusterInfo.TalosVersion).
-		Str("current_k8s", clusterInfo.K8sVersion).
-		Str("target_talos", m.config.Talos.Version).
-		Str("target_k8s", m.config.K8s.Version).
-		Int("total_nodes", len(clusterInfo.Nodes)).
-		Msg("Current vs target versions")
+	// Waits, drain and etcd checks and node selection come from the configuration, they must match the plan
+	if err := m.checkPlanConfig(ctx, plan); err != nil {
+		result.Errors = append(result.Errors, err)
+		return result, err
+	}
 
-	// Check if Talos upgrade is needed by examining individual nodes
-	talosNeedsUpgrade, nodesToUpgrade := m.checkTalosUpgradeNeeded(clusterInfo)
-	if len(nodesToUpgrade) > 0 {
-		log.Info().
-			Strs("nodes_to_upgrade", nodesToUpgrade).
-			Str("target_version", m.config.Talos.Version).
-			Msg("Some nodes need Talos upgrade")
+	// Change management only allows upgrades inside the configured maintenance windows
+	if err := m.checkMaintenanceWindow(); err != nil {
+		result.Errors = append(result.Errors, err)
+		return result, err
 	}
 
-	// Check if target Talos version is available
-	if err := version.ValidateTargetVersion(m.config.Talos.Version, version.TalosRelease); err != nil {
-		log.Warn().
-			Str("target_version", m.config.Talos.Version).
-			Msg("Target Talos version is not yet released - skipping Talos upgrade")
-		// Don't perform Talos upgrade, but continue to check Kubernetes
-	} else if talosNeedsUpgrade {
-		log.Info().Msg("Talos upgrade required")
-		if err := m.upgradeTalos(); err != nil {
+	log.Info().
+		Str("talos", plan.Talos.Current+" -> "+plan.Talos.Target).
+		Str("k8s", plan.Kubernetes.Current+" -> "+plan.Kubernetes.Target).
+		Int("steps", len(plan.Steps)).
+		Strs("skipped_nodes", skippedNodeNames(plan.SkippedNodes)).
+		Time("plan_created_at", plan.CreatedAt).
+		Msg("Executing upgrade plan")
+
+	for _, note := range plan.Notes {
+		log.Warn().Str("note", note).Msg("Upgrade plan note")
+	}
+
+	var windowClosed bool
+	if talosSteps := plan.phaseSteps(PhaseTalos); len(talosSteps) > 0 {
+		if err := m.upgradeTalosPath(ctx, talosSteps, result); err != nil {
 			result.Errors = append(result.Errors, fmt.Errorf("Talos upgrade failed: %w", err))
+			windowClosed = errors.Is(err, errOutsideMaintenanceWindow)
+			result.Interrupted = interrupted(ctx, err)
 		} else {
 			result.TalosUpgraded = true
 		}
-	} else {
-		log.Info().Msg("Talos is already at the target version")
 	}
 
-	// Check if target Kubernetes version is available
-	if err := version.ValidateTargetVersion(m.config.K8s.Version, version.KubernetesRelease); err != nil {
-		log.Warn().
-			Str("target_version", m.config.K8s.Version).
-			Msg("Target Kubernetes version is not yet released - skipping Kubernetes upgrade")
-    } else {
-        // Check if Kubernetes upgrade is needed. Consider both API server and kubelet versions.
-        k8sNeedsUpgradeAPIServer, err := version.NeedsUpgrade(clusterInfo.K8sVersion, m.config.K8s.Version)
-        if err != nil {
-            result.Errors = append(result.Errors, fmt.Errorf("failed to check Kubernetes API server version: %w", err))
-        }
-
-        // Inspect kubelet versions across nodes via Kubernetes API
-        kubeletNeedsUpgrade := false
-        if ctx := context.Background(); err == nil { // only attempt if no prior error
-            if kubeClusterInfo, kErr := k8s.GetClusterInfo(ctx); kErr == nil {
-                for _, n := range kubeClusterInfo.Nodes {
-                    if needs, vErr := version.NeedsUpgrade(n.KubeletVersion, m.config.K8s.Version); vErr == nil && needs {
-                        kubeletNeedsUpgrade = true
-                        break
-                    }
-                }
-            } else {
-                log.Debug().Err(kErr).Msg("Failed to get Kubernetes node info for kubelet version check")
-            }
-        }
-
-        k8sNeedsUpgrade := k8sNeedsUpgradeAPIServer || kubeletNeedsUpgrade
-
-        if k8sNeedsUpgrade {
-			log.Info().Msg("Kubernetes upgrade required")
-
-			// If Talos was upgraded, wait a bit before upgrading Kubernetes
-			if result.TalosUpgraded {
-				log.Info().Msg("Waiting for Talos upgrade to stabilize before upgrading Kubernetes")
-				time.Sleep(2 * time.Minute)
-			}
-
-			if err := m.upgradeKubernetes(); err != nil {
-				result.Errors = append(result.Errors, fmt.Errorf("Kubernetes upgrade failed: %w", err))
-			} else {
-				result.K8sUpgraded = true
-			}
-        } else {
-            log.Info().Msg("Kubernetes is already at the target version")
-        }
+	k8sSteps := plan.phaseSteps(PhaseKubernetes)
+	if len(k8sSteps) > 0 && !windowClosed && !result.Interrupted {
+		if err := m.checkInterrupted(ctx); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("Kubernetes upgrade not started: %w", err))
+			result.Interrupted = true
+		}
 	}
 
+	if len(k8sSteps) > 0 && windowClosed {
+		log.Warn().Msg("Maintenance window is closing - skipping Kubernetes upgrade")
+	} else if len(k8sSteps) > 0 && result.Interrupted {
+		log.Warn().Msg("Upgrade was interrupted - skipping Kubernetes upgrade")
+	} else if len(k8sSteps) > 0 {
+		// If Talos was upgraded, wait for the cluster to be healthy again before upgrading Kubernetes
+		var waitErr error
+		if result.TalosUpgraded {
+			log.Info().Msg("Waiting for the cluster to become healthy after the Talos upgrade before upgrading Kubernetes")
+			waitErr = waitForNodesHealthy(ctx, plan.nodeNames(PhaseKubernetes), "", m.config.Waits.Phase)
+		}
+
+		if waitErr != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("cluster did not become healthy after the Talos upgrade, skipping Kubernetes upgrade: %w", waitErr))
+			result.Interrupted = interrupted(ctx, waitErr)
+		} else if err := m.upgradeKubernetesPath(ctx, k8sSteps, result); err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("Kubernetes upgrade failed: %w", err))
+			result.Interrupted = interrupted(ctx, err)
+		} else {
+			result.K8sUpgraded = true
+		}
+	}
 	// Set final upgrade duration
 	result.UpgradeDuration = time.Since(startTime)
 
+	// An interrupted run stays open in the journal, so that --resume continues where it stopped
+	if result.Interrupted {
+		log.Warn().
+			Str("journal", m.journal.Path()).
+			Msg("Upgrade was interrupted before all nodes were upgraded, run it again with --resume to continue")
+	} else {
+		m.journal.Complete()
+	}
+
+	// Report the versions the nodes run now
+	if result.TalosUpgraded || result.K8sUpgraded || result.HasErrors() {
+		if clusterInfo, err := m.talosClient.GetClusterInfo(ctx); err != nil {
+			log.Debug().Err(err).Msg("Failed to get cluster information after the upgrade")
+		} else {
+			m.emitNodeVersions(ctx, clusterInfo.Nodes)
+		}
+	}
+
 	// Log final result
 	if result.HasErrors() {
 		log.Error().
@@ -194,6 +305,7 @@ func (m *Manager) PerformUpgrade() (*UpgradeResult, error) {
 			Bool("k8s_upgraded", result.K8sUpgraded).
 			Int("nodes_upgraded", len(result.NodesUpgraded)).
 			Int("nodes_failed", len(result.FailedNodes)).
+			Strs("nodes_skipped", skippedNodeNames(result.SkippedNodes)).
 			Dur("total_duration", result.UpgradeDuration).
 			Float64("success_rate", result.GetSuccessRate()).
 			Msg("Upgrade process completed with errors")
@@ -202,7 +314,17 @@ func (m *Manager) PerformUpgrade() (*UpgradeResult, error) {
 			log.Error().Err(err).Int("error_index", i).Msg("Upgrade error")
 		}
 
-		if result.RollbackRequired {
+		for _, rollback := range result.Rollbacks {
+			log.Warn().
+				Str("node", rollback.Node).
+				Str("failed_version", rollback.FailedVersion).
+				Str("target_version", rollback.TargetVersion).
+				Bool("succeeded", rollback.Succeeded).
+				Str("error", rollback.Error).
+				Msg("Node was rolled back")
+		}
+
+		if result.RollbackRequired && len(result.Rollbacks) == 0 {
 			log.Warn().Msg("Rollback may be required due to failed nodes")
 		}
 	} else {
@@ -210,6 +332,7 @@ func (m *Manager) PerformUpgrade() (*UpgradeResult, error) {
 			Bool("talos_upgraded", result.TalosUpgraded).
 			Bool("k8s_upgraded", result.K8sUpgraded).
 			Int("nodes_upgraded", len(result.NodesUpgraded)).
+			Strs("nodes_skipped", skippedNodeNames(result.SkippedNodes)).
 			Dur("total_duration", result.UpgradeDuration).
 			Msg("Upgrade process completed successfully")
 	}
@@ -217,136 +340,303 @@ func (m *Manager) PerformUpgrade() (*UpgradeResult, error) {
 	return result, nil
 }
 
-// upgradeTalos performs the Talos upgrade with configurable node ordering
-func (m *Manager) upgradeTalos() error {
+// upgradeTalosPath runs a full rolling Talos upgrade for every hop of the upgrade path in turn,
+// recording every node in result
+func (m *Manager) upgradeTalosPath(ctx context.Context, steps []PlanStep, result *UpgradeResult) error {
+	if len(steps) > 1 {
+		log.Info().
+			Strs("path", stepVersions(steps)).
+			Msg("Talos cannot skip minor releases, upgrading through each of them")
+	}
+
+	for i, step := range steps {
+		log.Info().
+			Str("phase", string(PhaseTalos)).
+			Str("target_version", step.Version).
+			Int("hop", i+1).
+			Int("hop_count", len(steps)).
+			Msg("Starting Talos upgrade hop")
+
+		m.setPhase(PhaseTalos, step.Version)
+		if err := m.upgradeTalos(ctx, step, result); err != nil {
+			return fmt.Errorf("upgrade to %s failed: %w", step.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// upgradeTalos performs the rolling Talos upgrade of a plan step, wave by wave.
+// Nodes that reached the step's version since the plan was made are left alone.
+func (m *Manager) upgradeTalos(ctx context.Context, step PlanStep, result *UpgradeResult) error {
 	log.Info().
-		Str("target_version", m.config.Talos.Version).
-		Str("image_id", m.config.Talos.ImageID).
-		Str("upgrade_order", string(m.config.Talos.UpgradeOrder)).
+		Str("target_version", step.Version).
+		Int("waves", len(step.Waves)).
 		Msg("Starting Talos upgrade")
 
 	startTime := time.Now()
 
-	// Get cluster info to determine node types
-	clusterInfo, err := m.talosClient.GetClusterInfo()
+	// Get cluster info to find the planned nodes
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get cluster info for upgrade planning: %w", err)
+		return fmt.Errorf("failed to get cluster info for Talos upgrade: %w", err)
 	}
 
-	// Separate control plane and worker nodes
-	var controlPlaneNodes, workerNodes []string
+	nodeMap := make(map[string]talos.NodeInfo)
 	for _, node := range clusterInfo.Nodes {
-		if node.IsControlPlane {
-			controlPlaneNodes = append(controlPlaneNodes, node.Name)
-		} else {
-			workerNodes = append(workerNodes, node.Name)
-		}
+		nodeMap[node.Name] = node
 	}
 
-	// Upgrade nodes based on configured order
-	if m.config.Talos.UpgradeOrder == "workers-first" {
-		// Upgrade worker nodes first
-		if len(workerNodes) > 0 {
-			log.Info().Msg("Upgrading worker nodes first")
-			err := m.upgradeNodesSequentially(workerNodes, clusterInfo.Nodes)
-			if err != nil {
-				log.Error().
-					Err(err).
-					Strs("nodes", workerNodes).
-					Msg("Worker node upgrade failed")
-				return fmt.Errorf("worker node upgrade failed: %w", err)
-			}
-
-			// Wait for workers to stabilize
-			log.Info().Msg("Waiting for worker nodes to stabilize...")
-			time.Sleep(2 * time.Minute)
+	images := make(map[string]string)
+	var installerImages map[string]string
+	waves := make([]wave, 0, len(step.Waves))
+	var nodeCount int
+	for _, planWave := range step.Waves {
+		w := wave{
+			name:              planWave.Name,
+			workerConcurrency: planWave.WorkerConcurrency,
+			soak:              planWave.Soak.Duration,
 		}
 
-		// Then upgrade control plane nodes
-		if len(controlPlaneNodes) > 0 {
-			log.Info().Msg("Upgrading control plane nodes")
-			err := m.upgradeNodesSequentially(controlPlaneNodes, clusterInfo.Nodes)
-			if err != nil {
-				log.Error().
-					Err(err).
-					Strs("nodes", controlPlaneNodes).
-					Msg("Control plane upgrade failed")
-				return fmt.Errorf("control plane upgrade failed: %w", err)
+		for _, planNode := range planWave.Nodes {
+			node, exists := nodeMap[planNode.Name]
+			if !exists {
+				return fmt.Errorf("planned node %s not found in cluster info", planNode.Name)
 			}
-		}
-	} else {
-		// Default: Upgrade control plane nodes first
-		if len(controlPlaneNodes) > 0 {
-			log.Info().Msg("Upgrading control plane nodes first")
-			err := m.upgradeNodesSequentially(controlPlaneNodes, clusterInfo.Nodes)
-			if err != nil {
-				log.Error().
-					Err(err).
-					Strs("nodes", controlPlaneNodes).
-					Msg("Control plane upgrade failed")
-				return fmt.Errorf("control plane upgrade failed: %w", err)
+
+			if needsUpgrade, err := version.NeedsUpgrade(node.TalosVersion, step.Version); err == nil && !needsUpgrade {
+				log.Info().
+					Str("node", node.Name).
+					Str("current_version", node.TalosVersion).
+					Msg("Node already at the planned version, skipping")
+				continue
 			}
 
-			// Wait for control plane to stabilize
-			log.Info().Msg("Waiting for control plane to stabilize...")
-			time.Sleep(2 * time.Minute)
-		}
+			images[node.Name] = planNode.Image
+			if images[node.Name] == "" {
+				// Plans written without images resolve them from the current configuration
+				if installerImages == nil {
+					installerImages, err = m.installerImages(ctx, clusterInfo.Nodes)
+					if err != nil {
+						return fmt.Errorf("failed to resolve installer images: %w", err)
+					}
+				}
+				images[node.Name] = installerImages[node.Name] + ":" + step.Version
+			}
 
-		// Then upgrade worker nodes
-		if len(workerNodes) > 0 {
-			log.Info().Msg("Upgrading worker nodes")
-			err := m.upgradeNodesSequentially(workerNodes, clusterInfo.Nodes)
-			if err != nil {
-				log.Error().
-					Err(err).
-					Strs("nodes", workerNodes).
-					Msg("Worker node upgrade failed")
-				return fmt.Errorf("worker node upgrade failed: %w", err)
+			if node.IsControlPlane {
+				w.controlPlaneNodes = append(w.controlPlaneNodes, node.Name)
+			} else {
+				w.workerNodes = append(w.workerNodes, node.Name)
 			}
+			nodeCount++
 		}
+
+		waves = append(waves, w)
+	}
+
+	err = m.runWaves(ctx, waves, "talos", "", func(nodeNames []string, concurrency int) error {
+		return m.upgradeNodes(ctx, nodeNames, clusterInfo.Nodes, concurrency, step.Version, images, result)
+	})
+	if err != nil {
+		return err
 	}
 
 	log.Info().
-		Str("target_version", m.config.Talos.Version).
+		Str("target_version", step.Version).
 		Dur("duration", time.Since(startTime)).
-		Int("total_nodes", len(controlPlaneNodes)+len(workerNodes)).
+		Int("total_nodes", nodeCount).
 		Msg("Talos upgrade completed successfully")
 
 	return nil
 }
 
-// upgradeNodesSequentially upgrades a list of nodes one by one
-func (m *Manager) upgradeNodesSequentially(nodeNames []string, allNodes []talos.NodeInfo) error {
-	return m.upgradeNodesSequentiallyWithResult(nodeNames, allNodes, nil)
-}
-
-// upgradeNodesSequentiallyWithResult upgrades a list of nodes one by one and tracks results
-func (m *Manager) upgradeNodesSequentiallyWithResult(nodeNames []string, allNodes []talos.NodeInfo, result *UpgradeResult) error {
+// upgradeNodes upgrades a list of nodes to targetVersion, using the image planned for each node, in batches of at most
+// concurrency nodes and tracks results. A failure in one batch, including a batch of a single node, stops later batches from starting.
+func (m *Manager) upgradeNodes(ctx context.Context, nodeNames []string, allNodes []talos.NodeInfo, concurrency int, targetVersion string, images map[string]string, result *UpgradeResult) error {
 	// Create a map for quick node lookup
 	nodeMap := make(map[string]talos.NodeInfo)
 	for _, node := range allNodes {
 		nodeMap[node.Name] = node
 	}
 
-	for i, nodeName := range nodeNames {
-		log.Info().
-			Str("node", nodeName).
-			Int("current", i+1).
-			Int("total", len(nodeNames)).
-			Msg("Starting upgrade for node")
-
-		// Get node info
-		nodeInfo, exists := nodeMap[nodeName]
-		if !exists {
+	// Make sure every node is known before anything is touched
+	for _, nodeName := range nodeNames {
+		if _, exists := nodeMap[nodeName]; !exists {
 			return fmt.Errorf("node %s not found in cluster info", nodeName)
 		}
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	for batchStart := 0; batchStart < len(nodeNames); batchStart += concurrency {
+		batch := nodeNames[batchStart:min(batchStart+concurrency, len(nodeNames))]
+
+		// A stopped run lets the previous batch finish, but starts no further nodes
+		if err := m.checkInterrupted(ctx); err != nil {
+			return err
+		}
 
-		// Construct the full image reference by combining imageID with version
-		fullImageRef := m.config.Talos.ImageID + ":" + m.config.Talos.Version
+		// Never start nodes that would still be upgrading when the maintenance window closes
+		if err := m.checkWindowBeforeNodes(PhaseTalos, batch); err != nil {
+			return err
+		}
+
+		if concurrency > 1 {
+			log.Info().
+				Strs("nodes", batch).
+				Int("batch_size", len(batch)).
+				Int("max_unavailable", concurrency).
+				Msg("Starting upgrade batch")
+		}
+
+		var wg sync.WaitGroup
+		var failedMu sync.Mutex
+		var failedNodes []string
+		var stopErr error
+
+		for i, nodeName := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				log.Info().
+					Str("node", nodeName).
+					Int("current", batchStart+i+1).
+					Int("total", len(nodeNames)).
+					Msg("Starting upgrade for node")
+
+				nodeStart := time.Now()
+				if err := m.upgradeTalosNode(ctx, nodeMap[nodeName], allNodes, targetVersion, images[nodeName], result); err != nil {
+					failedMu.Lock()
+					failedNodes = append(failedNodes, nodeName)
+					if errors.Is(err, errStopRollout) {
+						stopErr = err
+					}
+					failedMu.Unlock()
+					return
+				}
+				m.recordNodeDuration(PhaseTalos, time.Since(nodeStart))
+			}()
+		}
+		wg.Wait()
+
+		if stopErr != nil {
+			log.Error().
+				Err(stopErr).
+				Strs("failed_nodes", failedNodes).
+				Msg("Stopping rollout, remaining nodes will not be upgraded")
+			return stopErr
+		}
+
+		// The failed nodes are left for investigation rather than taking down further nodes
+		if len(failedNodes) > 0 {
+			log.Error().
+				Strs("failed_nodes", failedNodes).
+				Msg("Upgrade batch failed, not starting remaining batches")
+			return fmt.Errorf("upgrade batch failed on nodes %v", failedNodes)
+		}
+	}
+
+	// Monitor the overall upgrade progress for all nodes
+	log.Info().Strs("nodes", nodeNames).Msg("Starting post-upgrade monitoring")
+	err := m.monitorUpgradeProgress(ctx, targetVersion, nodeNames, "talos")
+	if err != nil {
+		log.Error().Err(err).Msg("Upgrade monitoring detected issues")
+		// Failed nodes were already rolled back individually when talos.rollbackOnFailure is set
+		return fmt.Errorf("upgrade monitoring failed: %w", err)
+	}
+
+	return nil
+}
+
+// upgradeTalosNode upgrades a single node to targetVersion using image and waits for it to come back, returning an error if the node failed.
+// Errors wrapping errStopRollout mean no further nodes may be upgraded.
+func (m *Manager) upgradeTalosNode(ctx context.Context, nodeInfo talos.NodeInfo, allNodes []talos.NodeInfo, targetVersion, image string, result *UpgradeResult) (err error) {
+	nodeName := nodeInfo.Name
+
+	// Skip nodes a previous, interrupted run already finished
+	state := m.journal.NodeState(PhaseTalos, targetVersion, nodeName)
+	if state == NodeCompleted {
+		log.Info().Str("node", nodeName).Msg("Node already upgraded according to journal, skipping")
+		if result != nil {
+			result.AddUpgradedNode(nodeName)
+		}
+		return nil
+	}
+
+	record := result.startNode(PhaseTalos, targetVersion, nodeName, nodeInfo.TalosVersion)
+	defer func() {
+		result.finishNode(record, m.journal.NodeAttempts(PhaseTalos, targetVersion, nodeName), err, ctx.Err() != nil)
+	}()
+
+	var bootTime uint64
+	if state == NodeUpgradeInitiated {
+		// The upgrade request was already accepted before the interruption,
+		// so only the reboot wait remains for this node
+		bootTime = m.journal.NodeBootTime(PhaseTalos, targetVersion, nodeName)
+		log.Info().Str("node", nodeName).Msg("Resuming node whose upgrade was already initiated, waiting for node to reboot")
+	} else {
+		m.recordNode(PhaseTalos, targetVersion, nodeName, NodeStarted, nil)
+
+		// Never take a control plane node down while etcd is in trouble
+		if nodeInfo.IsControlPlane && m.config.Etcd.HealthCheck {
+			if err := m.checkEtcdBeforeNode(ctx, nodeName, allNodes); err != nil {
+				log.Error().
+					Str("node", nodeName).
+					Err(err).
+					Msg("etcd health gate refused control plane node upgrade")
+
+				m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
+				if result != nil {
+					result.AddFailedNode(nodeName)
+					result.AddError(fmt.Errorf("etcd health gate refused upgrade of node %s: %w", nodeName, err))
+				}
+				return err
+			}
+		}
+
+		// Remember when the node booted, so its reboot can be told apart from it still running the old version
+		bootCtx, bootCancel := context.WithTimeout(ctx, 30*time.Second)
+		var err error
+		bootTime, err = m.talosClient.GetNodeBootTime(bootCtx, nodeInfo.Endpoint)
+		bootCancel()
+		if err != nil {
+			log.Error().
+				Str("node", nodeName).
+				Err(err).
+				Msg("Failed to get node boot time, skipping its upgrade")
+
+			m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
+			if result != nil {
+				result.AddFailedNode(nodeName)
+				result.AddError(fmt.Errorf("failed to get boot time of node %s: %w", nodeName, err))
+			}
+			return err
+		}
+
+		// Move workloads off the node before the upgrade reboots it
+		if m.config.Drain.Enabled {
+			if err := m.cordonAndDrainNode(ctx, nodeName); err != nil {
+				log.Error().
+					Str("node", nodeName).
+					Err(err).
+					Msg("Failed to drain node, skipping its upgrade")
+
+				m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
+				if result != nil {
+					result.AddFailedNode(nodeName)
+					result.AddError(fmt.Errorf("failed to drain node %s: %w", nodeName, err))
+				}
+				return err
+			}
+		}
 
 		// Upgrade the node
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
-		err := m.talosClient.UpgradeNode(ctx, nodeInfo.Endpoint, fullImageRef)
+		upgradeCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+		err = m.talosClient.UpgradeNode(upgradeCtx, nodeInfo.Endpoint, image)
 		cancel()
 
 		if err != nil {
@@ -355,157 +645,254 @@ func (m *Manager) upgradeNodesSequentiallyWithResult(nodeNames []string, allNode
 				Err(err).
 				Msg("Failed to upgrade node")
 
+			m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
 			if result != nil {
 				result.AddFailedNode(nodeName)
-				result.Errors = append(result.Errors, fmt.Errorf("failed to upgrade node %s: %w", nodeName, err))
+				result.AddError(fmt.Errorf("failed to upgrade node %s: %w", nodeName, err))
 			}
 
-			// Continue with other nodes instead of failing completely
-			continue
+			// The node never rebooted, so let workloads back onto it
+			if m.config.Drain.Enabled {
+				m.uncordonNode(ctx, nodeName)
+			}
+			return err
 		}
 
+		m.recordUpgradeInitiated(PhaseTalos, targetVersion, nodeName, bootTime)
 		log.Info().Str("node", nodeName).Msg("Upgrade initiated, waiting for node to reboot")
+	}
 
-		// Wait for the node to reboot and come back online
-		waitCtx, waitCancel := context.WithTimeout(context.Background(), 8*time.Minute)
-		err = m.talosClient.WaitForNodeReboot(waitCtx, nodeInfo.Endpoint, 8*time.Minute)
-		waitCancel()
+	// Wait for the node to reboot and come back online
+	err = m.talosClient.WaitForNodeReboot(ctx, nodeInfo.Endpoint, bootTime, m.config.Waits.RebootTimeout)
 
-		if err != nil {
-			log.Warn().
+	// Make sure the node actually booted into the target version
+	if err == nil {
+		err = m.verifyNodeTalosVersion(ctx, nodeInfo, targetVersion)
+	}
+
+	if err != nil {
+		log.Warn().
+			Str("node", nodeName).
+			Err(err).
+			Msg("Node did not come back on the target version")
+
+		m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
+		if result != nil {
+			result.AddFailedNode(nodeName)
+			result.AddError(fmt.Errorf("node %s failed to come back on the target version: %w", nodeName, err))
+		}
+
+		// An aborted run leaves the node alone, a resumed run waits for it again
+		if m.config.Talos.RollbackOnFailure && ctx.Err() == nil {
+			if rollbackErr := m.rollbackNode(ctx, nodeInfo, targetVersion, result); rollbackErr != nil && result != nil {
+				result.AddError(fmt.Errorf("rollback of node %s failed: %w", nodeName, rollbackErr))
+			}
+		}
+		return err
+	}
+
+	// The etcd member on the node must have rejoined before the next control plane node goes down
+	if nodeInfo.IsControlPlane && m.config.Etcd.HealthCheck {
+		if err := m.waitForEtcdAfterNode(ctx, nodeName, allNodes); err != nil {
+			log.Error().
 				Str("node", nodeName).
 				Err(err).
-				Msg("Node may not have come back online within timeout")
+				Msg("etcd did not recover after control plane node upgrade")
 
+			m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
 			if result != nil {
 				result.AddFailedNode(nodeName)
-				result.Errors = append(result.Errors, fmt.Errorf("node %s failed to come back online: %w", nodeName, err))
-			}
-		} else {
-			log.Info().Str("node", nodeName).Msg("Node upgrade completed successfully")
-
-			if result != nil {
-				result.AddUpgradedNode(nodeName)
+				result.AddError(fmt.Errorf("etcd did not recover after upgrading node %s: %w", nodeName, err))
 			}
+			return err
 		}
+	}
+
+	// Only move on, and let workloads back, once the node is Ready and its static pods run again
+	if err := waitForNodesHealthy(ctx, []string{nodeName}, "", m.config.Waits.Node); err != nil {
+		log.Warn().
+			Str("node", nodeName).
+			Err(err).
+			Msg("Node did not become healthy within timeout")
 
-		// Wait a bit between nodes to avoid overwhelming the cluster
-		if i < len(nodeNames)-1 {
-			log.Info().Msg("Waiting before upgrading next node...")
-			time.Sleep(30 * time.Second)
+		m.recordNode(PhaseTalos, targetVersion, nodeName, failedState(ctx), err)
+		if result != nil {
+			result.AddFailedNode(nodeName)
+			result.AddError(fmt.Errorf("node %s did not become healthy: %w", nodeName, err))
 		}
+		return err
 	}
 
-	// Monitor the overall upgrade progress for all nodes
-	log.Info().Strs("nodes", nodeNames).Msg("Starting post-upgrade monitoring")
-	ctx := context.Background()
-	err := m.monitorUpgradeProgress(ctx, m.config.Talos.Version, nodeNames, "talos")
+	if m.config.Drain.Enabled {
+		m.uncordonNode(ctx, nodeName)
+	}
+
+	log.Info().Str("node", nodeName).Msg("Node upgrade completed successfully")
+
+	m.recordNode(PhaseTalos, targetVersion, nodeName, NodeCompleted, nil)
+	if result != nil {
+		result.AddUpgradedNode(nodeName)
+	}
+
+	return nil
+}
+
+// verifyNodeTalosVersion checks that a node reports the target Talos version after its reboot
+func (m *Manager) verifyNodeTalosVersion(ctx context.Context, nodeInfo talos.NodeInfo, targetVersion string) error {
+	versionCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	currentVersion, err := m.talosClient.GetNodeTalosVersion(versionCtx, nodeInfo.Endpoint)
 	if err != nil {
-		log.Error().Err(err).Msg("Upgrade monitoring detected issues")
-		// Note: In a production system, you might want to trigger rollback here
-		return fmt.Errorf("upgrade monitoring failed: %w", err)
+		return fmt.Errorf("failed to get Talos version after reboot: %w", err)
+	}
+
+	if currentVersion != targetVersion {
+		return fmt.Errorf("node reports Talos version %s after reboot, expected %s", currentVersion, targetVersion)
+	}
+
+	return nil
+}
+
+// cordonAndDrainNode cordons a node and evicts its pods, uncordoning it again if the drain fails
+func (m *Manager) cordonAndDrainNode(ctx context.Context, nodeName string) error {
+	if err := k8s.CordonNode(ctx, nodeName); err != nil {
+		return fmt.Errorf("failed to cordon node: %w", err)
+	}
+
+	err := k8s.DrainNode(ctx, nodeName, k8s.DrainOptions{
+		Timeout:            m.config.Drain.Timeout,
+		GracePeriod:        m.config.Drain.GracePeriod,
+		IgnoreDaemonSets:   m.config.Drain.IgnoreDaemonSets,
+		DeleteEmptyDirData: m.config.Drain.DeleteEmptyDirData,
+		Force:              m.config.Drain.Force,
+	})
+	if err != nil {
+		m.uncordonNode(ctx, nodeName)
+		return err
+	}
+
+	return nil
+}
+
+// uncordonNode makes a node schedulable again, logging instead of failing since the upgrade itself already finished.
+// It runs even when ctx was cancelled, so an aborted run does not leave the node cordoned.
+func (m *Manager) uncordonNode(ctx context.Context, nodeName string) {
+	uncordonCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+
+	if err := k8s.UncordonNode(uncordonCtx, nodeName); err != nil {
+		log.Error().
+			Str("node", nodeName).
+			Err(err).
+			Msg("Failed to uncordon node, it must be uncordoned manually")
+	}
+}
+
+// upgradeKubernetesPath upgrades Kubernetes one minor version at a time along the upgrade path,
+// verifying that the cluster fully runs each step before starting the next one, and records every node in result
+func (m *Manager) upgradeKubernetesPath(ctx context.Context, steps []PlanStep, result *UpgradeResult) error {
+	if len(steps) > 1 {
+		log.Info().
+			Strs("path", stepVersions(steps)).
+			Msg("Kubernetes cannot skip minor versions, upgrading through each of them")
+	}
+
+	for i, step := range steps {
+		log.Info().
+			Str("phase", string(PhaseKubernetes)).
+			Str("target_version", step.Version).
+			Int("step", i+1).
+			Int("step_count", len(steps)).
+			Msg("Starting Kubernetes upgrade step")
+
+		m.setPhase(PhaseKubernetes, step.Version)
+		if err := m.upgradeKubernetes(ctx, step, result); err != nil {
+			return fmt.Errorf("upgrade to %s failed: %w", step.Version, err)
+		}
+
+		if err := m.verifyKubernetesStep(ctx, step); err != nil {
+			return fmt.Errorf("upgrade to %s could not be verified: %w", step.Version, err)
+		}
 	}
 
 	return nil
 }
 
-// upgradeKubernetes performs the Kubernetes upgrade with configurable node ordering
-func (m *Manager) upgradeKubernetes() error {
+// upgradeKubernetes performs the Kubernetes upgrade of a plan step, wave by wave.
+// Kubernetes is upgraded one node at a time regardless of the wave's concurrency.
+func (m *Manager) upgradeKubernetes(ctx context.Context, step PlanStep, result *UpgradeResult) error {
 	log.Info().
-		Str("target_version", m.config.K8s.Version).
-		Str("upgrade_order", string(m.config.K8s.UpgradeOrder)).
+		Str("target_version", step.Version).
+		Int("waves", len(step.Waves)).
 		Msg("Starting Kubernetes upgrade")
 
 	startTime := time.Now()
 
-	// Get cluster info to determine node types
-	clusterInfo, err := m.talosClient.GetClusterInfo()
+	// Get cluster info to find the planned nodes
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get cluster info for Kubernetes upgrade: %w", err)
 	}
 
-	// Separate control plane and worker nodes
-	var controlPlaneNodes []string
-	var workerNodes []string
-
+	nodeMap := make(map[string]talos.NodeInfo)
 	for _, node := range clusterInfo.Nodes {
-		if node.IsControlPlane {
-			controlPlaneNodes = append(controlPlaneNodes, node.Name)
-		} else {
-			workerNodes = append(workerNodes, node.Name)
-		}
+		nodeMap[node.Name] = node
 	}
 
-	log.Info().
-		Int("control_plane_nodes", len(controlPlaneNodes)).
-		Int("worker_nodes", len(workerNodes)).
-		Msg("Node categorization for Kubernetes upgrade complete")
-
-	// Upgrade Kubernetes based on configured order
-	if m.config.K8s.UpgradeOrder == "workers-first" {
-		// Upgrade worker nodes first
-		if len(workerNodes) > 0 {
-			log.Info().Msg("Upgrading Kubernetes on worker nodes first")
-			err := m.upgradeKubernetesOnNodes(workerNodes, clusterInfo.Nodes)
-			if err != nil {
-				return fmt.Errorf("worker node Kubernetes upgrade failed: %w", err)
-			}
-
-			// Wait for workers to stabilize
-			log.Info().Msg("Waiting for worker nodes to stabilize after Kubernetes upgrade...")
-			time.Sleep(1 * time.Minute)
+	waves := make([]wave, 0, len(step.Waves))
+	var nodeCount int
+	for _, planWave := range step.Waves {
+		w := wave{
+			name:              planWave.Name,
+			workerConcurrency: 1,
+			soak:              planWave.Soak.Duration,
 		}
 
-		// Then upgrade control plane nodes
-		if len(controlPlaneNodes) > 0 {
-			log.Info().Msg("Upgrading Kubernetes on control plane nodes")
-			err := m.upgradeKubernetesOnNodes(controlPlaneNodes, clusterInfo.Nodes)
-			if err != nil {
-				return fmt.Errorf("control plane Kubernetes upgrade failed: %w", err)
+		for _, planNode := range planWave.Nodes {
+			node, exists := nodeMap[planNode.Name]
+			if !exists {
+				return fmt.Errorf("planned node %s not found in cluster info", planNode.Name)
 			}
-		}
-	} else {
-		// Default: Upgrade control plane nodes first
-		if len(controlPlaneNodes) > 0 {
-			log.Info().Msg("Upgrading Kubernetes on control plane nodes first")
-			err := m.upgradeKubernetesOnNodes(controlPlaneNodes, clusterInfo.Nodes)
-			if err != nil {
-				return fmt.Errorf("control plane Kubernetes upgrade failed: %w", err)
-			}
-
-			// Wait for control plane to stabilize
-			log.Info().Msg("Waiting for control plane to stabilize after Kubernetes upgrade...")
-			time.Sleep(1 * time.Minute)
-		}
 
-		// Then upgrade worker nodes
-		if len(workerNodes) > 0 {
-			log.Info().Msg("Upgrading Kubernetes on worker nodes")
-			err := m.upgradeKubernetesOnNodes(workerNodes, clusterInfo.Nodes)
-			if err != nil {
-				return fmt.Errorf("worker node Kubernetes upgrade failed: %w", err)
+			if node.IsControlPlane {
+				w.controlPlaneNodes = append(w.controlPlaneNodes, node.Name)
+			} else {
+				w.workerNodes = append(w.workerNodes, node.Name)
 			}
+			nodeCount++
 		}
+
+		waves = append(waves, w)
+	}
+
+	err = m.runWaves(ctx, waves, "kubernetes", step.Version, func(nodeNames []string, _ int) error {
+		return m.upgradeKubernetesOnNodes(ctx, nodeNames, clusterInfo.Nodes, step.Version, result)
+	})
+	if err != nil {
+		return fmt.Errorf("Kubernetes upgrade failed: %w", err)
 	}
 
 	log.Info().
-		Str("target_version", m.config.K8s.Version).
-		Str("upgrade_order", string(m.config.K8s.UpgradeOrder)).
+		Str("target_version", step.Version).
 		Dur("duration", time.Since(startTime)).
-		Int("total_nodes", len(controlPlaneNodes)+len(workerNodes)).
+		Int("total_nodes", nodeCount).
 		Msg("Kubernetes upgrade completed successfully")
 
 	return nil
 }
 
-// upgradeKubernetesOnNodes upgrades Kubernetes on a list of nodes using Talos API
-func (m *Manager) upgradeKubernetesOnNodes(nodeNames []string, allNodes []talos.NodeInfo) error {
+// upgradeKubernetesOnNodes upgrades Kubernetes on a list of nodes to targetVersion using Talos API
+func (m *Manager) upgradeKubernetesOnNodes(ctx context.Context, nodeNames []string, allNodes []talos.NodeInfo, targetVersion string, result *UpgradeResult) error {
 	// Create a map for quick node lookup
 	nodeMap := make(map[string]talos.NodeInfo)
 	for _, node := range allNodes {
 		nodeMap[node.Name] = node
 	}
 
+	// The kubelet versions the nodes run before their upgrade, for the report
+	kubeletVersions := m.kubeletVersions(ctx)
+
 	for i, nodeName := range nodeNames {
 		log.Info().
 			Str("node", nodeName).
@@ -519,25 +906,48 @@ func (m *Manager) upgradeKubernetesOnNodes(nodeNames []string, allNodes []talos.
 			return fmt.Errorf("node %s not found in cluster info", nodeName)
 		}
 
+		// Skip nodes a previous, interrupted run already finished
+		if m.journal.NodeState(PhaseKubernetes, targetVersion, nodeName) == NodeCompleted {
+			log.Info().Str("node", nodeName).Msg("Kubernetes already upgraded on node according to journal, skipping")
+			result.AddUpgradedNode(nodeName)
+			continue
+		}
+
+		// A stopped run lets the previous node finish, but starts no further nodes
+		if err := m.checkInterrupted(ctx); err != nil {
+			return err
+		}
+
+		// Never start a node that would still be upgrading when the maintenance window closes
+		if err := m.checkWindowBeforeNodes(PhaseKubernetes, []string{nodeName}); err != nil {
+			return err
+		}
+
 		// Upgrade Kubernetes on the node using Talos API
-		err := m.upgradeKubernetesOnSingleNode(nodeInfo)
+		nodeStart := time.Now()
+		record := result.startNode(PhaseKubernetes, targetVersion, nodeName, kubeletVersions[nodeName])
+		m.recordNode(PhaseKubernetes, targetVersion, nodeName, NodeStarted, nil)
+		err := m.upgradeKubernetesOnSingleNode(ctx, nodeInfo, targetVersion)
+		if err == nil {
+			// The node is done once its kubelet reports the target version and its static pods run again
+			err = waitForNodesHealthy(ctx, []string{nodeName}, targetVersion, m.config.Waits.Node)
+		}
+		result.finishNode(record, m.journal.NodeAttempts(PhaseKubernetes, targetVersion, nodeName), err, ctx.Err() != nil)
 		if err != nil {
+			m.recordNode(PhaseKubernetes, targetVersion, nodeName, failedState(ctx), err)
+			result.AddFailedNode(nodeName)
 			return fmt.Errorf("failed to upgrade Kubernetes on node %s: %w", nodeName, err)
 		}
+		m.recordNode(PhaseKubernetes, targetVersion, nodeName, NodeCompleted, nil)
+		m.recordNodeDuration(PhaseKubernetes, time.Since(nodeStart))
+		result.AddUpgradedNode(nodeName)
 
 		log.Info().Str("node", nodeName).Msg("Kubernetes upgrade completed for node")
-
-		// Wait a bit between nodes to avoid overwhelming the cluster
-		if i < len(nodeNames)-1 {
-			log.Info().Msg("Waiting before upgrading Kubernetes on next node...")
-			time.Sleep(30 * time.Second)
-		}
 	}
 
 	// Monitor the Kubernetes upgrade progress for all nodes
 	log.Info().Strs("nodes", nodeNames).Msg("Starting post-Kubernetes-upgrade monitoring")
-	ctx := context.Background()
-	err := m.monitorUpgradeProgress(ctx, m.config.K8s.Version, nodeNames, "kubernetes")
+	err := m.monitorUpgradeProgress(ctx, targetVersion, nodeNames, "kubernetes")
 	if err != nil {
 		log.Error().Err(err).Msg("Kubernetes upgrade monitoring detected issues")
 		// Note: In a production system, you might want to trigger rollback here
@@ -547,27 +957,28 @@ func (m *Manager) upgradeKubernetesOnNodes(nodeNames []string, allNodes []talos.
 	return nil
 }
 
-// upgradeKubernetesOnSingleNode upgrades Kubernetes on a single node using Talos API
-func (m *Manager) upgradeKubernetesOnSingleNode(nodeInfo talos.NodeInfo) error {
+// upgradeKubernetesOnSingleNode upgrades Kubernetes on a single node to targetVersion using Talos API
+func (m *Manager) upgradeKubernetesOnSingleNode(ctx context.Context, nodeInfo talos.NodeInfo, targetVersion string) error {
 	log.Info().
 		Str("node", nodeInfo.Name).
 		Str("endpoint", nodeInfo.Endpoint).
-		Str("target_version", m.config.K8s.Version).
+		Str("target_version", targetVersion).
 		Msg("Upgrading Kubernetes on single node using Talos machine configuration")
 
 	// Create a context with timeout for the upgrade operation
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	upgradeCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
 	// Use the k8s package function to upgrade Kubernetes using Talos cluster API
-	err := k8s.UpgradeKubernetesOnNode(ctx, m.talosClient.GetClient(), m.talosClient.GetConfig(), nodeInfo.Endpoint, m.config.K8s.Version)
+	err := k8s.UpgradeKubernetesOnNode(upgradeCtx, m.talosClient.GetClient(), m.talosClient.GetConfig(), nodeInfo.Endpoint, targetVersion)
 	if err != nil {
 		return fmt.Errorf("failed to upgrade Kubernetes on node %s: %w", nodeInfo.Name, err)
 	}
 
 	log.Info().
 		Str("node", nodeInfo.Name).
-		Str("version", m.config.K8s.Version).
+		Str("phase", string(PhaseKubernetes)).
+		Str("target_version", targetVersion).
 		Msg("Kubernetes upgrade completed successfully on node")
 
 	return nil
@@ -593,6 +1004,9 @@ func (m *Manager) monitorUpgradeProgress(ctx context.Context, targetVersion stri
 	for {
 		select {
 		case <-timeoutCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("upgrade monitoring aborted: %w", err)
+			}
 			if len(failedNodes) > 0 {
 				log.Error().
 					Strs("failed_nodes", failedNodes).
@@ -616,7 +1030,7 @@ func (m *Manager) monitorUpgradeProgress(ctx context.Context, targetVersion stri
 				}
 
 				// Check node status
-				healthy, err := m.checkNodeHealth(nodeName, targetVersion, upgradeType)
+				healthy, err := m.checkNodeHealth(ctx, nodeName, targetVersion, upgradeType)
 				if err != nil {
 					log.Debug().
 						Str("node", nodeName).
@@ -653,9 +1067,9 @@ func (m *Manager) monitorUpgradeProgress(ctx context.Context, targetVersion stri
 }
 
 // checkNodeHealth checks if a node has successfully completed its upgrade
-func (m *Manager) checkNodeHealth(nodeName, targetVersion, upgradeType string) (bool, error) {
+func (m *Manager) checkNodeHealth(ctx context.Context, nodeName, targetVersion, upgradeType string) (bool, error) {
 	// Get current cluster information
-	clusterInfo, err := m.talosClient.GetClusterInfo()
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
 	if err != nil {
 		return false, fmt.Errorf("failed to get cluster info: %w", err)
 	}
@@ -671,15 +1085,15 @@ func (m *Manager) checkNodeHealth(nodeName, targetVersion, upgradeType string) (
 			switch upgradeType {
 			case "talos":
 				return node.TalosVersion == targetVersion, nil
-            case "kubernetes":
-                // Accept both plain and 'v'-prefixed versions
-                if clusterInfo.K8sVersion == targetVersion {
-                    return true, nil
-                }
-                if "v"+clusterInfo.K8sVersion == targetVersion || clusterInfo.K8sVersion == strings.TrimPrefix(targetVersion, "v") {
-                    return true, nil
-                }
-                return false, nil
+			case "kubernetes":
+				// Accept both plain and 'v'-prefixed versions
+				if clusterInfo.K8sVersion == targetVersion {
+					return true, nil
+				}
+				if "v"+clusterInfo.K8sVersion == targetVersion || clusterInfo.K8sVersion == strings.TrimPrefix(targetVersion, "v") {
+					return true, nil
+				}
+				return false, nil
 			default:
 				return false, fmt.Errorf("unknown upgrade type: %s", upgradeType)
 			}
@@ -700,18 +1114,23 @@ func contains(slice []string, item string) bool {
 }
 
 // validateUpgradePrerequisites checks if the cluster is ready for upgrade
-func (m *Manager) validateUpgradePrerequisites() error {
+func (m *Manager) validateUpgradePrerequisites(ctx context.Context) error {
 	log.Info().Msg("Validating upgrade prerequisites")
 
 	// Get current cluster information
-	clusterInfo, err := m.talosClient.GetClusterInfo()
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get cluster information for validation: %w", err)
 	}
 
-	// Check if all nodes are ready
+	// Check if all nodes selected for upgrade are ready; excluded nodes may be held back precisely because they are not
+	selectedNodes, _, err := m.selectNodes(ctx, clusterInfo.Nodes)
+	if err != nil {
+		return fmt.Errorf("failed to select nodes for validation: %w", err)
+	}
+
 	var notReadyNodes []string
-	for _, node := range clusterInfo.Nodes {
+	for _, node := range selectedNodes {
 		if !node.Ready {
 			notReadyNodes = append(notReadyNodes, node.Name)
 		}
@@ -733,6 +1152,11 @@ func (m *Manager) validateUpgradePrerequisites() error {
 		return fmt.Errorf("no control plane nodes found in cluster")
 	}
 
+	// Refuse upgrades that would pass through an unsupported Talos and Kubernetes combination
+	if err := m.checkCompatibility(ctx, clusterInfo, selectedNodes); err != nil {
+		return fmt.Errorf("incompatible Talos and Kubernetes versions: %w", err)
+	}
+
 	log.Info().
 		Int("total_nodes", len(clusterInfo.Nodes)).
 		Int("control_plane_nodes", controlPlaneCount).
@@ -742,72 +1166,189 @@ func (m *Manager) validateUpgradePrerequisites() error {
 	return nil
 }
 
-// CheckOnly performs a dry-run check without actually upgrading
-func (m *Manager) CheckOnly() error {
+// CheckStatus sums up a CheckResult
+type CheckStatus string
+
+const (
+	// CheckUpToDate means the cluster runs the target versions
+	CheckUpToDate CheckStatus = "up-to-date"
+	// CheckUpgradeAvailable means Talos or Kubernetes drifted from a released target version
+	CheckUpgradeAvailable CheckStatus = "upgrade-available"
+	// CheckNotReleased means nothing can be upgraded because a target version is not released yet
+	CheckNotReleased CheckStatus = "not-released"
+)
+
+// CheckResult is the outcome of comparing the cluster with the target versions
+type CheckResult struct {
+	Status                CheckStatus   `json:"status"`
+	CurrentTalos          string        `json:"currentTalos"`
+	TargetTalos           string        `json:"targetTalos"`
+	TalosVersionAvailable bool          `json:"talosVersionAvailable"`
+	TalosNeedsUpgrade     bool          `json:"talosNeedsUpgrade"`
+	TalosUpgradePath      []string      `json:"talosUpgradePath,omitempty"`
+	CurrentK8s            string        `json:"currentK8s"`
+	TargetK8s             string        `json:"targetK8s"`
+	K8sVersionAvailable   bool          `json:"k8sVersionAvailable"`
+	K8sNeedsUpgrade       bool          `json:"k8sNeedsUpgrade"`
+	K8sUpgradePath        []string      `json:"k8sUpgradePath,omitempty"`
+	SelectedNodes         int           `json:"selectedNodes"`
+	SkippedNodes          []SkippedNode `json:"skippedNodes,omitempty"`
+}
+
+// NeedsUpgrade returns true if Talos or Kubernetes drifted from the target versions
+func (r *CheckResult) NeedsUpgrade() bool {
+	return r.TalosNeedsUpgrade || r.K8sNeedsUpgrade
+}
+
+// Check compares the cluster with the target versions without upgrading anything
+func (m *Manager) Check(ctx context.Context) (*CheckResult, error) {
 	// Get current cluster information
-	clusterInfo, err := m.talosClient.GetClusterInfo()
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get cluster information: %w", err)
+		return nil, fmt.Errorf("failed to get cluster information: %w", err)
 	}
+	m.emitNodeVersions(ctx, clusterInfo.Nodes)
 
-	// Check Talos version
-	talosNeedsUpgrade, err := version.NeedsUpgrade(clusterInfo.TalosVersion, m.config.Talos.Version)
+	// Hold back nodes excluded by node selection
+	selectedNodes, skippedNodes, err := m.selectNodes(ctx, clusterInfo.Nodes)
 	if err != nil {
-		return fmt.Errorf("failed to check Talos version: %w", err)
+		return nil, fmt.Errorf("failed to select nodes for upgrade: %w", err)
 	}
 
+	// An upgrade that passes through an unsupported combination would be refused, so report it here too
+	if err := m.checkCompatibility(ctx, clusterInfo, selectedNodes); err != nil {
+		return nil, fmt.Errorf("incompatible Talos and Kubernetes versions: %w", err)
+	}
+
+	result := &CheckResult{
+		CurrentTalos:          clusterInfo.TalosVersion,
+		TargetTalos:           m.config.Talos.Version,
+		TalosVersionAvailable: true,
+		CurrentK8s:            clusterInfo.K8sVersion,
+		TargetK8s:             m.config.K8s.Version,
+		K8sVersionAvailable:   true,
+		SelectedNodes:         len(selectedNodes),
+		SkippedNodes:          skippedNodes,
+	}
+
+	// Check Talos version on every selected node
+	result.TalosNeedsUpgrade, _ = m.checkTalosUpgradeNeeded(selectedNodes)
+
 	// Check if target Talos version is available
-	talosVersionAvailable := true
 	if err := version.ValidateTargetVersion(m.config.Talos.Version, version.TalosRelease); err != nil {
 		log.Warn().
 			Str("target_version", m.config.Talos.Version).
 			Msg("Target Talos version is not yet released - skipping Talos upgrade check")
-		talosVersionAvailable = false
-		talosNeedsUpgrade = false // Don't upgrade if version not available
+		result.TalosVersionAvailable = false
+		result.TalosNeedsUpgrade = false // Don't upgrade if version not available
+	}
+
+	// Show every minor release the Talos upgrade has to pass through
+	if result.TalosNeedsUpgrade {
+		result.TalosUpgradePath, err = m.talosUpgradePath(ctx, selectedNodes)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to compute Talos upgrade path")
+		}
 	}
 
 	// Check if target Kubernetes version is available
-	k8sNeedsUpgrade := false
-	k8sVersionAvailable := true
 	if err := version.ValidateTargetVersion(m.config.K8s.Version, version.KubernetesRelease); err != nil {
 		log.Warn().
 			Str("target_version", m.config.K8s.Version).
 			Msg("Target Kubernetes version is not yet released - skipping Kubernetes upgrade check")
-		k8sVersionAvailable = false
+		result.K8sVersionAvailable = false
 	} else {
 		// Check Kubernetes version only if target version is available
-		var err error
-		k8sNeedsUpgrade, err = version.NeedsUpgrade(clusterInfo.K8sVersion, m.config.K8s.Version)
+		result.K8sNeedsUpgrade, err = version.NeedsUpgrade(clusterInfo.K8sVersion, m.config.K8s.Version)
 		if err != nil {
-			return fmt.Errorf("failed to check Kubernetes version: %w", err)
+			return nil, fmt.Errorf("failed to check Kubernetes version: %w", err)
 		}
 	}
 
+	// Show every minor version the Kubernetes upgrade has to pass through
+	if result.K8sNeedsUpgrade {
+		result.K8sUpgradePath, err = m.kubernetesUpgradePath(ctx, clusterInfo.K8sVersion)
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to compute Kubernetes upgrade path")
+		}
+	}
+
+	// A pending upgrade outweighs a target that is not released yet, the drift can still be acted on
+	switch {
+	case result.NeedsUpgrade():
+		result.Status = CheckUpgradeAvailable
+	case !result.TalosVersionAvailable || !result.K8sVersionAvailable:
+		result.Status = CheckNotReleased
+	default:
+		result.Status = CheckUpToDate
+	}
+
+	return result, nil
+}
+
+// Write renders the check result to w as "json" or "yaml"
+func (r *CheckResult) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode check result as JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(r)
+		if err != nil {
+			return fmt.Errorf("failed to encode check result as YAML: %w", err)
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unsupported check result format '%s': must be 'json' or 'yaml'", format)
+	}
+}
+
+// CheckOnly performs a dry-run check without actually upgrading and logs its findings
+func (m *Manager) CheckOnly(ctx context.Context) (*CheckResult, error) {
+	result, err := m.Check(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Report findings
 	logEvent := log.Info().
-		Str("current_talos", clusterInfo.TalosVersion).
-		Str("target_talos", m.config.Talos.Version).
-		Bool("talos_needs_upgrade", talosNeedsUpgrade).
-		Str("current_k8s", clusterInfo.K8sVersion).
-		Str("target_k8s", m.config.K8s.Version)
-
-	if !talosVersionAvailable {
+		Str("current_talos", result.CurrentTalos).
+		Str("target_talos", result.TargetTalos).
+		Bool("talos_needs_upgrade", result.TalosNeedsUpgrade).
+		Strs("talos_upgrade_path", result.TalosUpgradePath).
+		Str("current_k8s", result.CurrentK8s).
+		Str("target_k8s", result.TargetK8s).
+		Strs("k8s_upgrade_path", result.K8sUpgradePath).
+		Int("selected_nodes", result.SelectedNodes).
+		Strs("skipped_nodes", skippedNodeNames(result.SkippedNodes))
+
+	if !result.TalosVersionAvailable {
 		logEvent = logEvent.Str("talos_status", "version not available")
 	}
-	if !k8sVersionAvailable {
+	if !result.K8sVersionAvailable {
 		logEvent = logEvent.Str("k8s_status", "version not available")
 	} else {
-		logEvent = logEvent.Bool("k8s_needs_upgrade", k8sNeedsUpgrade)
+		logEvent = logEvent.Bool("k8s_needs_upgrade", result.K8sNeedsUpgrade)
 	}
 
-	if !talosVersionAvailable || !k8sVersionAvailable {
+	if !result.TalosVersionAvailable || !result.K8sVersionAvailable {
 		logEvent.Msg("Upgrade checks completed (some versions not available)")
 	} else {
 		logEvent.Msg("All upgrade checks completed")
 	}
 
-	if !talosNeedsUpgrade && !k8sNeedsUpgrade {
-		if talosVersionAvailable && k8sVersionAvailable {
+	// Report whether an upgrade would be allowed to start right now
+	if err := m.checkMaintenanceWindow(); err != nil {
+		log.Warn().Err(err).Msg("An upgrade started now would be refused")
+	}
+
+	if !result.NeedsUpgrade() {
+		if result.TalosVersionAvailable && result.K8sVersionAvailable {
 			log.Info().Msg("No upgrades needed - cluster is up to date")
 		} else {
 			log.Info().Msg("No upgrades needed for available versions - some versions skipped (not yet released)")
@@ -816,14 +1357,14 @@ func (m *Manager) CheckOnly() error {
 		log.Info().Msg("Upgrades are needed - run without --check-only to perform upgrades")
 	}
 
-	return nil
+	return result, nil
 }
 
-// checkTalosUpgradeNeeded checks if any nodes need Talos upgrade
-func (m *Manager) checkTalosUpgradeNeeded(clusterInfo *talos.ClusterInfo) (bool, []string) {
+// checkTalosUpgradeNeeded checks if any of the given nodes need Talos upgrade
+func (m *Manager) checkTalosUpgradeNeeded(nodes []talos.NodeInfo) (bool, []string) {
 	var nodesToUpgrade []string
 
-	for _, node := range clusterInfo.Nodes {
+	for _, node := range nodes {
 		needsUpgrade, err := version.NeedsUpgrade(node.TalosVersion, m.config.Talos.Version)
 		if err != nil {
 			log.Warn().
@@ -0,0 +1,87 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/talos"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+)
+
+// talosUpgradePath returns the Talos versions the nodes are upgraded through, one minor release
+// at a time, starting from the oldest version any of them runs and ending with talos.version
+func (m *Manager) talosUpgradePath(ctx context.Context, nodes []talos.NodeInfo) ([]string, error) {
+	var oldest string
+	for _, node := range nodes {
+		if oldest == "" {
+			oldest = node.TalosVersion
+			continue
+		}
+		comparison, err := version.Compare(node.TalosVersion, oldest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compare Talos version of node %s: %w", node.Name, err)
+		}
+		if comparison == version.Older {
+			oldest = node.TalosVersion
+		}
+	}
+
+	if oldest == "" {
+		return nil, nil
+	}
+
+	path, err := version.ComputeUpgradePath(ctx, version.TalosRelease, oldest, m.config.Talos.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute Talos upgrade path from %s to %s: %w", oldest, m.config.Talos.Version, err)
+	}
+
+	return path, nil
+}
+
+// kubernetesUpgradePath returns the Kubernetes versions the cluster is upgraded through, one minor
+// version at a time at the latest patch of each, starting from the current API server version and
+// ending with k8s.version
+func (m *Manager) kubernetesUpgradePath(ctx context.Context, current string) ([]string, error) {
+	path, err := version.ComputeUpgradePath(ctx, version.KubernetesRelease, current, m.config.K8s.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute Kubernetes upgrade path from %s to %s: %w", current, m.config.K8s.Version, err)
+	}
+
+	// The API server may already run the target while kubelets still lag behind
+	if len(path) == 0 {
+		path = []string{m.config.K8s.Version}
+	}
+
+	return path, nil
+}
+
+// verifyKubernetesStep checks that the API server and the kubelet of every node planned for the step
+// run its version, waiting up to waits.phase.timeout for the nodes to become healthy on it
+func (m *Manager) verifyKubernetesStep(ctx context.Context, step PlanStep) error {
+	targetVersion := step.Version
+
+	apiServerVersion, err := k8s.GetKubernetesVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get API server version: %w", err)
+	}
+
+	if strings.TrimPrefix(apiServerVersion, "v") != strings.TrimPrefix(targetVersion, "v") {
+		return fmt.Errorf("API server reports version %s, expected %s", apiServerVersion, targetVersion)
+	}
+
+	nodeNames := step.nodeNames()
+	if err := waitForNodesHealthy(ctx, nodeNames, targetVersion, m.config.Waits.Phase); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("phase", string(PhaseKubernetes)).
+		Str("target_version", targetVersion).
+		Int("nodes", len(nodeNames)).
+		Msg("Kubernetes upgrade step verified")
+
+	return nil
+}
@@ -0,0 +1,580 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/talos"
+	"github.com/bouquet2/water/version"
+	"github.com/rs/zerolog/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PlanFormatVersion is the version of the plan file format written by BuildPlan
+const PlanFormatVersion = 1
+
+// Plan is the exact, ordered sequence of actions an upgrade performs. It can be reviewed
+// before the upgrade and later run as-is with ExecutePlan.
+type Plan struct {
+	FormatVersion int            `json:"formatVersion"`
+	CreatedAt     time.Time      `json:"createdAt"`
+	Talos         PlanVersions   `json:"talos"`
+	Kubernetes    PlanVersions   `json:"kubernetes"`
+	Schematic     *PlanSchematic `json:"schematic,omitempty"`
+	Steps         []PlanStep     `json:"steps"`
+	SkippedNodes  []SkippedNode  `json:"skippedNodes,omitempty"`
+	Waits         PlanWaits      `json:"waits"`
+	Notes         []string       `json:"notes,omitempty"`
+}
+
+// PlanVersions is the version the cluster runs when the plan is made and the version it is upgraded to
+type PlanVersions struct {
+	Current string `json:"current"`
+	Target  string `json:"target"`
+}
+
+// PlanSchematic is the schematic declared in talos.schematic, as registered with the Image Factory
+type PlanSchematic struct {
+	ID         string `json:"id"`
+	FactoryURL string `json:"factoryUrl"`
+	Image      string `json:"image"`
+}
+
+// PlanStep is a full rolling pass that brings its nodes to a single version
+type PlanStep struct {
+	Phase   Phase      `json:"phase"`
+	Version string     `json:"version"`
+	Waves   []PlanWave `json:"waves"`
+}
+
+// PlanWave is a group of nodes upgraded together within a step. Control plane nodes
+// go one at a time before the workers, which go workerConcurrency at a time.
+type PlanWave struct {
+	Name              string          `json:"name"`
+	WorkerConcurrency int             `json:"workerConcurrency"`
+	Soak              metav1.Duration `json:"soak"`
+	Nodes             []PlanNode      `json:"nodes"`
+}
+
+// PlanNode is a single node upgraded within a wave
+type PlanNode struct {
+	Name           string `json:"name"`
+	ControlPlane   bool   `json:"controlPlane,omitempty"`
+	CurrentVersion string `json:"currentVersion,omitempty"`
+	Image          string `json:"image,omitempty"`
+}
+
+// PlanWaits are the expected waits between the actions of the plan
+type PlanWaits struct {
+	DrainTimeout      *metav1.Duration `json:"drainTimeout,omitempty"`
+	RebootTimeout     metav1.Duration  `json:"rebootTimeout"`
+	EtcdHealthTimeout *metav1.Duration `json:"etcdHealthTimeout,omitempty"`
+	NodeMinSoak       metav1.Duration  `json:"nodeMinSoak"`
+	NodeTimeout       metav1.Duration  `json:"nodeTimeout"`
+	PhaseMinSoak      metav1.Duration  `json:"phaseMinSoak"`
+	PhaseTimeout      metav1.Duration  `json:"phaseTimeout"`
+}
+
+// phaseSteps returns the steps of the given phase, in plan order
+func (p *Plan) phaseSteps(phase Phase) []PlanStep {
+	var steps []PlanStep
+	for _, step := range p.Steps {
+		if step.Phase == phase {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+// stepVersions returns the version of each step
+func stepVersions(steps []PlanStep) []string {
+	versions := make([]string, 0, len(steps))
+	for _, step := range steps {
+		versions = append(versions, step.Version)
+	}
+	return versions
+}
+
+// nodeNames returns the names of the nodes upgraded in the step, in plan order
+func (s PlanStep) nodeNames() []string {
+	var names []string
+	for _, planWave := range s.Waves {
+		for _, node := range planWave.Nodes {
+			names = append(names, node.Name)
+		}
+	}
+	return names
+}
+
+// nodeNames returns the names of all nodes upgraded in steps of the given phase, in plan order
+func (p *Plan) nodeNames(phase Phase) []string {
+	var names []string
+	for _, step := range p.Steps {
+		if step.Phase != phase {
+			continue
+		}
+		for _, planWave := range step.Waves {
+			for _, node := range planWave.Nodes {
+				if !contains(names, node.Name) {
+					names = append(names, node.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// BuildPlan works out every hop, wave and node the upgrade to the configured versions goes through
+func (m *Manager) BuildPlan(ctx context.Context) (*Plan, error) {
+	log.Info().Msg("Building upgrade plan")
+
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster information: %w", err)
+	}
+
+	log.Info().
+		Str("current_talos", clusterInfo.TalosVersion).
+		Str("current_k8s", clusterInfo.K8sVersion).
+		Str("target_talos", m.config.Talos.Version).
+		Str("target_k8s", m.config.K8s.Version).
+		Int("total_nodes", len(clusterInfo.Nodes)).
+		Msg("Current vs target versions")
+
+	// Hold back nodes excluded by node selection
+	selectedNodes, skippedNodes, err := m.selectNodes(ctx, clusterInfo.Nodes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select nodes for upgrade: %w", err)
+	}
+
+	if len(skippedNodes) > 0 {
+		log.Info().
+			Strs("skipped_nodes", skippedNodeNames(skippedNodes)).
+			Int("selected_nodes", len(selectedNodes)).
+			Msg("Some nodes are excluded from the upgrade")
+	}
+
+	plan := &Plan{
+		FormatVersion: PlanFormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Talos:         PlanVersions{Current: clusterInfo.TalosVersion, Target: m.config.Talos.Version},
+		Kubernetes:    PlanVersions{Current: clusterInfo.K8sVersion, Target: m.config.K8s.Version},
+		SkippedNodes:  skippedNodes,
+		Waits:         m.planWaits(),
+	}
+
+	// Check if Talos upgrade is needed by examining individual nodes
+	talosNeedsUpgrade, nodesToUpgrade := m.checkTalosUpgradeNeeded(selectedNodes)
+	if len(nodesToUpgrade) > 0 {
+		log.Info().
+			Strs("nodes_to_upgrade", nodesToUpgrade).
+			Str("target_version", m.config.Talos.Version).
+			Msg("Some nodes need Talos upgrade")
+	}
+
+	// Check if target Talos version is available
+	if m.journal.ResumePhase() == PhaseKubernetes {
+		log.Info().
+			Str("journal", m.journal.Path()).
+			Msg("Journal shows the Talos phase already finished - resuming at the Kubernetes phase")
+	} else if err := version.ValidateTargetVersion(m.config.Talos.Version, version.TalosRelease); err != nil {
+		log.Warn().
+			Str("target_version", m.config.Talos.Version).
+			Msg("Target Talos version is not yet released - skipping Talos upgrade")
+		plan.Notes = append(plan.Notes, fmt.Sprintf("Talos %s is not yet released, the Talos upgrade is skipped", m.config.Talos.Version))
+	} else if talosNeedsUpgrade {
+		log.Info().Msg("Talos upgrade required")
+		talosPath, err := m.talosUpgradePath(ctx, selectedNodes)
+		if err != nil {
+			return nil, err
+		}
+
+		if m.factory != nil {
+			schematicID, err := m.schematicID(ctx)
+			if err != nil {
+				return nil, err
+			}
+			plan.Schematic = &PlanSchematic{
+				ID:         schematicID,
+				FactoryURL: m.config.Talos.Schematic.FactoryURL,
+				Image:      m.factory.InstallerImage(schematicID),
+			}
+		}
+
+		// Each hop starts from the versions the previous hop left the nodes on
+		nodes := append([]talos.NodeInfo{}, selectedNodes...)
+		for _, hop := range talosPath {
+			step, err := m.planTalosStep(ctx, nodes, hop)
+			if err != nil {
+				return nil, fmt.Errorf("failed to plan Talos upgrade to %s: %w", hop, err)
+			}
+			plan.Steps = append(plan.Steps, step)
+
+			for i := range nodes {
+				if needsUpgrade, err := version.NeedsUpgrade(nodes[i].TalosVersion, hop); err != nil || needsUpgrade {
+					nodes[i].TalosVersion = hop
+				}
+			}
+		}
+	} else {
+		log.Info().Msg("Talos is already at the target version")
+	}
+
+	// Check if target Kubernetes version is available
+	if err := version.ValidateTargetVersion(m.config.K8s.Version, version.KubernetesRelease); err != nil {
+		log.Warn().
+			Str("target_version", m.config.K8s.Version).
+			Msg("Target Kubernetes version is not yet released - skipping Kubernetes upgrade")
+		plan.Notes = append(plan.Notes, fmt.Sprintf("Kubernetes %s is not yet released, the Kubernetes upgrade is skipped", m.config.K8s.Version))
+		return plan, nil
+	}
+
+	// Check if Kubernetes upgrade is needed. Consider both API server and kubelet versions.
+	k8sNeedsUpgradeAPIServer, err := version.NeedsUpgrade(clusterInfo.K8sVersion, m.config.K8s.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check Kubernetes API server version: %w", err)
+	}
+
+	kubeletVersions := m.kubeletVersions(ctx)
+	kubeletNeedsUpgrade := false
+	for _, node := range selectedNodes {
+		if needs, vErr := version.NeedsUpgrade(kubeletVersions[node.Name], m.config.K8s.Version); vErr == nil && needs {
+			kubeletNeedsUpgrade = true
+			break
+		}
+	}
+
+	if !k8sNeedsUpgradeAPIServer && !kubeletNeedsUpgrade {
+		log.Info().Msg("Kubernetes is already at the target version")
+		return plan, nil
+	}
+
+	log.Info().Msg("Kubernetes upgrade required")
+	k8sPath, err := m.kubernetesUpgradePath(ctx, clusterInfo.K8sVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each step starts from the versions the previous step left the kubelets on
+	stepVersions := maps.Clone(kubeletVersions)
+	for _, k8sStep := range k8sPath {
+		step, err := m.planKubernetesStep(ctx, selectedNodes, stepVersions, k8sStep)
+		if err != nil {
+			return nil, fmt.Errorf("failed to plan Kubernetes upgrade to %s: %w", k8sStep, err)
+		}
+		plan.Steps = append(plan.Steps, step)
+
+		for _, node := range selectedNodes {
+			if needsUpgrade, err := version.NeedsUpgrade(stepVersions[node.Name], k8sStep); err != nil || needsUpgrade {
+				stepVersions[node.Name] = k8sStep
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// planTalosStep plans the rolling Talos upgrade to targetVersion of the nodes not yet at or past it
+func (m *Manager) planTalosStep(ctx context.Context, selectedNodes []talos.NodeInfo, targetVersion string) (PlanStep, error) {
+	var pendingNodes []talos.NodeInfo
+	for _, node := range selectedNodes {
+		needsUpgrade, err := version.NeedsUpgrade(node.TalosVersion, targetVersion)
+		if err != nil || needsUpgrade {
+			pendingNodes = append(pendingNodes, node)
+		}
+	}
+
+	// Control plane nodes always go one at a time, workers may run in parallel batches
+	var workerCount int
+	for _, node := range pendingNodes {
+		if !node.IsControlPlane {
+			workerCount++
+		}
+	}
+
+	workerConcurrency, err := m.config.Talos.WorkerConcurrency(workerCount)
+	if err != nil {
+		return PlanStep{}, fmt.Errorf("invalid talos.maxUnavailable: %w", err)
+	}
+
+	waves, err := m.planWaves(ctx, pendingNodes, m.config.Talos.UpgradeOrder, workerConcurrency)
+	if err != nil {
+		return PlanStep{}, fmt.Errorf("failed to plan upgrade waves: %w", err)
+	}
+
+	images, err := m.installerImages(ctx, pendingNodes)
+	if err != nil {
+		return PlanStep{}, fmt.Errorf("failed to resolve installer images: %w", err)
+	}
+
+	return PlanStep{
+		Phase:   PhaseTalos,
+		Version: targetVersion,
+		Waves: planStepWaves(waves, pendingNodes, func(node talos.NodeInfo) PlanNode {
+			return PlanNode{
+				Name:           node.Name,
+				ControlPlane:   node.IsControlPlane,
+				CurrentVersion: node.TalosVersion,
+				Image:          images[node.Name] + ":" + targetVersion,
+			}
+		}),
+	}, nil
+}
+
+// planKubernetesStep plans the rolling Kubernetes upgrade to targetVersion, one node at a time, from the
+// kubelet versions the step starts with
+func (m *Manager) planKubernetesStep(ctx context.Context, selectedNodes []talos.NodeInfo, kubeletVersions map[string]string, targetVersion string) (PlanStep, error) {
+	waves, err := m.planWaves(ctx, selectedNodes, m.config.K8s.UpgradeOrder, 1)
+	if err != nil {
+		return PlanStep{}, fmt.Errorf("failed to plan upgrade waves: %w", err)
+	}
+
+	return PlanStep{
+		Phase:   PhaseKubernetes,
+		Version: targetVersion,
+		Waves: planStepWaves(waves, selectedNodes, func(node talos.NodeInfo) PlanNode {
+			return PlanNode{
+				Name:           node.Name,
+				ControlPlane:   node.IsControlPlane,
+				CurrentVersion: kubeletVersions[node.Name],
+			}
+		}),
+	}, nil
+}
+
+// planStepWaves turns waves into plan waves, leaving out waves without nodes
+func planStepWaves(waves []wave, nodes []talos.NodeInfo, planNode func(talos.NodeInfo) PlanNode) []PlanWave {
+	nodeMap := make(map[string]talos.NodeInfo)
+	for _, node := range nodes {
+		nodeMap[node.Name] = node
+	}
+
+	var planWaves []PlanWave
+	for _, w := range waves {
+		if w.size() == 0 {
+			continue
+		}
+
+		planWave := PlanWave{
+			Name:              w.name,
+			WorkerConcurrency: w.workerConcurrency,
+			Soak:              metav1.Duration{Duration: w.soak},
+		}
+		for _, nodeName := range append(append([]string{}, w.controlPlaneNodes...), w.workerNodes...) {
+			planWave.Nodes = append(planWave.Nodes, planNode(nodeMap[nodeName]))
+		}
+		planWaves = append(planWaves, planWave)
+	}
+
+	return planWaves
+}
+
+// planWaits returns the configured waits between upgrade actions
+func (m *Manager) planWaits() PlanWaits {
+	waits := PlanWaits{
+		RebootTimeout: metav1.Duration{Duration: m.config.Waits.RebootTimeout},
+		NodeMinSoak:   metav1.Duration{Duration: m.config.Waits.Node.MinSoak},
+		NodeTimeout:   metav1.Duration{Duration: m.config.Waits.Node.Timeout},
+		PhaseMinSoak:  metav1.Duration{Duration: m.config.Waits.Phase.MinSoak},
+		PhaseTimeout:  metav1.Duration{Duration: m.config.Waits.Phase.Timeout},
+	}
+
+	if m.config.Drain.Enabled {
+		waits.DrainTimeout = &metav1.Duration{Duration: m.config.Drain.Timeout}
+	}
+	if m.config.Etcd.HealthCheck {
+		waits.EtcdHealthTimeout = &metav1.Duration{Duration: m.config.Etcd.HealthTimeout}
+	}
+
+	return waits
+}
+
+// checkPlanConfig refuses a plan made with other waits, drain or etcd settings than the configuration has
+// now, or that holds back other nodes than the configuration and the skip annotations do now. Those are
+// taken from the configuration while the plan runs, so running the plan would not do what it shows.
+func (m *Manager) checkPlanConfig(ctx context.Context, plan *Plan) error {
+	if !plan.Waits.equal(m.planWaits()) {
+		return fmt.Errorf("plan was made with other waits, drain or etcd settings than the configuration has now, make a new plan")
+	}
+
+	clusterInfo, err := m.talosClient.GetClusterInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get cluster information: %w", err)
+	}
+
+	_, skippedNodes, err := m.selectNodes(ctx, clusterInfo.Nodes)
+	if err != nil {
+		return fmt.Errorf("failed to select nodes for upgrade: %w", err)
+	}
+
+	planned := skippedNodeNames(plan.SkippedNodes)
+	current := skippedNodeNames(skippedNodes)
+	slices.Sort(planned)
+	slices.Sort(current)
+	if !slices.Equal(planned, current) {
+		return fmt.Errorf("plan holds back nodes %v, but the configuration now holds back nodes %v, make a new plan", planned, current)
+	}
+
+	return nil
+}
+
+// equal reports whether both waits are the same
+func (w PlanWaits) equal(other PlanWaits) bool {
+	optionalEqual := func(a, b *metav1.Duration) bool {
+		if a == nil || b == nil {
+			return a == b
+		}
+		return a.Duration == b.Duration
+	}
+
+	return optionalEqual(w.DrainTimeout, other.DrainTimeout) &&
+		optionalEqual(w.EtcdHealthTimeout, other.EtcdHealthTimeout) &&
+		w.RebootTimeout == other.RebootTimeout &&
+		w.NodeMinSoak == other.NodeMinSoak &&
+		w.NodeTimeout == other.NodeTimeout &&
+		w.PhaseMinSoak == other.PhaseMinSoak &&
+		w.PhaseTimeout == other.PhaseTimeout
+}
+
+// kubeletVersions returns the kubelet version of every node, keyed by node name
+func (m *Manager) kubeletVersions(ctx context.Context) map[string]string {
+	versions := make(map[string]string)
+
+	kubeClusterInfo, err := k8s.GetClusterInfo(ctx)
+	if err != nil {
+		log.Debug().Err(err).Msg("Failed to get Kubernetes node info for kubelet version check")
+		return versions
+	}
+
+	for _, node := range kubeClusterInfo.Nodes {
+		versions[node.Name] = node.KubeletVersion
+	}
+
+	return versions
+}
+
+// LoadPlan reads a plan written by BuildPlan, in either JSON or YAML
+func LoadPlan(path string) (*Plan, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan file: %w", err)
+	}
+
+	var plan Plan
+	if err := yaml.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan file: %w", err)
+	}
+
+	if plan.FormatVersion != PlanFormatVersion {
+		return nil, fmt.Errorf("plan file has format version %d, expected %d", plan.FormatVersion, PlanFormatVersion)
+	}
+
+	return &plan, nil
+}
+
+// Write renders the plan to w as "text", "json" or "yaml"
+func (p *Plan) Write(w io.Writer, format string) error {
+	switch format {
+	case "text":
+		return p.writeText(w)
+	case "json":
+		data, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode plan as JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(p)
+		if err != nil {
+			return fmt.Errorf("failed to encode plan as YAML: %w", err)
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unsupported plan format '%s': must be 'text', 'json' or 'yaml'", format)
+	}
+}
+
+// writeText renders the plan for humans
+func (p *Plan) writeText(w io.Writer) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Upgrade plan (created %s)\n", p.CreatedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "  Talos:      %s -> %s\n", p.Talos.Current, p.Talos.Target)
+	fmt.Fprintf(&b, "  Kubernetes: %s -> %s\n", p.Kubernetes.Current, p.Kubernetes.Target)
+	if p.Schematic != nil {
+		fmt.Fprintf(&b, "  Schematic:  %s from %s\n", p.Schematic.ID, p.Schematic.FactoryURL)
+	}
+
+	if len(p.Steps) == 0 {
+		b.WriteString("\nNo upgrades needed - cluster is up to date\n")
+	}
+
+	for i, step := range p.Steps {
+		fmt.Fprintf(&b, "\nStep %d/%d: %s %s\n", i+1, len(p.Steps), phaseTitle(step.Phase), step.Version)
+		for _, planWave := range step.Waves {
+			fmt.Fprintf(&b, "  Wave %s (workers %d at a time, soak %s)\n", planWave.Name, planWave.WorkerConcurrency, planWave.Soak.Duration)
+			for _, node := range planWave.Nodes {
+				role := "worker"
+				if node.ControlPlane {
+					role = "control plane"
+				}
+				fmt.Fprintf(&b, "    - %s (%s) %s -> %s", node.Name, role, node.CurrentVersion, step.Version)
+				if node.Image != "" {
+					fmt.Fprintf(&b, " using %s", node.Image)
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+
+	if len(p.SkippedNodes) > 0 {
+		b.WriteString("\nSkipped nodes:\n")
+		for _, skipped := range p.SkippedNodes {
+			fmt.Fprintf(&b, "  - %s: %s\n", skipped.Name, skipped.Reason)
+		}
+	}
+
+	b.WriteString("\nWaits:\n")
+	if p.Waits.DrainTimeout != nil {
+		fmt.Fprintf(&b, "  Drain:        up to %s per node\n", p.Waits.DrainTimeout.Duration)
+	}
+	fmt.Fprintf(&b, "  Reboot:       up to %s per node\n", p.Waits.RebootTimeout.Duration)
+	if p.Waits.EtcdHealthTimeout != nil {
+		fmt.Fprintf(&b, "  etcd health:  up to %s per control plane node\n", p.Waits.EtcdHealthTimeout.Duration)
+	}
+	fmt.Fprintf(&b, "  Node health:  at least %s, up to %s per node\n", p.Waits.NodeMinSoak.Duration, p.Waits.NodeTimeout.Duration)
+	fmt.Fprintf(&b, "  Phase health: at least %s, up to %s between waves and phases\n", p.Waits.PhaseMinSoak.Duration, p.Waits.PhaseTimeout.Duration)
+
+	if len(p.Notes) > 0 {
+		b.WriteString("\nNotes:\n")
+		for _, note := range p.Notes {
+			fmt.Fprintf(&b, "  - %s\n", note)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// phaseTitle returns the display name of a plan phase
+func phaseTitle(phase Phase) string {
+	switch phase {
+	case PhaseTalos:
+		return "Talos"
+	case PhaseKubernetes:
+		return "Kubernetes"
+	default:
+		return string(phase)
+	}
+}
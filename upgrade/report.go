@@ -0,0 +1,339 @@
+package upgrade
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NodeRecord is what happened to one node in one Talos hop or Kubernetes step of an upgrade run
+type NodeRecord struct {
+	Node          string `json:"node"`
+	Phase         Phase  `json:"phase"`
+	TargetVersion string `json:"targetVersion"`
+	FromVersion   string `json:"fromVersion,omitempty"`
+	// ToVersion is the version the node runs afterwards, empty when it is not known
+	ToVersion  string          `json:"toVersion,omitempty"`
+	State      NodeState       `json:"state"`
+	StartedAt  time.Time       `json:"startedAt"`
+	FinishedAt time.Time       `json:"finishedAt,omitzero"`
+	Duration   metav1.Duration `json:"duration"`
+	// Attempts counts this run and the interrupted runs it was resumed from
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Report is the record of an upgrade run, written by --report
+type Report struct {
+	StartedAt          time.Time       `json:"startedAt"`
+	FinishedAt         time.Time       `json:"finishedAt"`
+	Duration           metav1.Duration `json:"duration"`
+	Succeeded          bool            `json:"succeeded"`
+	Interrupted        bool            `json:"interrupted,omitempty"`
+	Talos              PlanVersions    `json:"talos"`
+	Kubernetes         PlanVersions    `json:"kubernetes"`
+	TalosUpgraded      bool            `json:"talosUpgraded"`
+	KubernetesUpgraded bool            `json:"kubernetesUpgraded"`
+	Nodes              []NodeRecord    `json:"nodes"`
+	SkippedNodes       []SkippedNode   `json:"skippedNodes,omitempty"`
+	Errors             []string        `json:"errors,omitempty"`
+}
+
+// startNode starts the record of a node's upgrade and returns its index for finishNode
+func (r *UpgradeResult) startNode(phase Phase, targetVersion, nodeName, fromVersion string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Nodes = append(r.Nodes, NodeRecord{
+		Node:          nodeName,
+		Phase:         phase,
+		TargetVersion: targetVersion,
+		FromVersion:   fromVersion,
+		State:         NodeStarted,
+		StartedAt:     time.Now(),
+	})
+	return len(r.Nodes) - 1
+}
+
+// finishNode completes the record started by startNode. A node that failed its Talos upgrade
+// but was rolled back is recorded as rolled back, on the version it returned to, a node whose
+// work was cut short by aborting the run as aborted.
+func (r *UpgradeResult) finishNode(index, attempts int, nodeErr error, aborted bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record := &r.Nodes[index]
+	record.FinishedAt = time.Now()
+	record.Duration = metav1.Duration{Duration: record.FinishedAt.Sub(record.StartedAt)}
+	// Without a journal only this run is known
+	record.Attempts = max(attempts, 1)
+
+	if nodeErr == nil {
+		record.State = NodeCompleted
+		record.ToVersion = record.TargetVersion
+		return
+	}
+
+	record.State = NodeFailed
+	record.Error = nodeErr.Error()
+	if aborted {
+		record.State = NodeAborted
+		return
+	}
+	if record.Phase != PhaseTalos {
+		return
+	}
+	for _, rollback := range r.Rollbacks {
+		if rollback.Node == record.Node && rollback.FailedVersion == record.TargetVersion && rollback.Succeeded {
+			record.State = NodeRolledBack
+			record.ToVersion = rollback.TargetVersion
+		}
+	}
+}
+
+// Report returns the record of the run
+func (r *UpgradeResult) Report() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := Report{
+		StartedAt:          r.StartedAt,
+		FinishedAt:         r.StartedAt.Add(r.UpgradeDuration),
+		Duration:           metav1.Duration{Duration: r.UpgradeDuration},
+		Succeeded:          len(r.Errors) == 0,
+		Interrupted:        r.Interrupted,
+		Talos:              r.Talos,
+		Kubernetes:         r.Kubernetes,
+		TalosUpgraded:      r.TalosUpgraded,
+		KubernetesUpgraded: r.K8sUpgraded,
+		Nodes:              append(make([]NodeRecord, 0, len(r.Nodes)), r.Nodes...),
+		SkippedNodes:       r.SkippedNodes,
+	}
+	for _, err := range r.Errors {
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	return report
+}
+
+// WriteReport renders the record of the run to w as "json", "junit" or "markdown"
+func (r *UpgradeResult) WriteReport(w io.Writer, format string) error {
+	report := r.Report()
+
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode report as JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	case "junit":
+		return report.writeJUnit(w)
+	case "markdown":
+		return report.writeMarkdown(w)
+	default:
+		return fmt.Errorf("unsupported report format '%s': must be 'json', 'junit' or 'markdown'", format)
+	}
+}
+
+// junitTestSuites is the root element of a JUnit XML report
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite groups the test cases of one Talos hop or Kubernetes step
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is a single node, or the run as a whole
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+// junitMessage is the failure or skip reason of a test case
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// add appends a test case and updates the counts of the suite
+func (s *junitTestSuite) add(testCase junitTestCase) {
+	s.Cases = append(s.Cases, testCase)
+	s.Tests++
+	s.Time += testCase.Time
+	if testCase.Failure != nil {
+		s.Failures++
+	}
+	if testCase.Skipped != nil {
+		s.Skipped++
+	}
+}
+
+// writeJUnit renders the report as JUnit XML, with a test suite per Talos hop and Kubernetes step
+// and a test case per node, so that CI systems show failed nodes as failed tests. A final suite
+// holds the run itself, which fails whenever the run had errors.
+func (r Report) writeJUnit(w io.Writer) error {
+	var suites []junitTestSuite
+	suiteIndex := make(map[string]int)
+
+	for _, node := range r.Nodes {
+		suiteName := fmt.Sprintf("%s %s", node.Phase, node.TargetVersion)
+		i, exists := suiteIndex[suiteName]
+		if !exists {
+			i = len(suites)
+			suiteIndex[suiteName] = i
+			suites = append(suites, junitTestSuite{Name: suiteName, Timestamp: node.StartedAt.Format(time.RFC3339)})
+		}
+
+		testCase := junitTestCase{
+			Name:      node.Node,
+			ClassName: fmt.Sprintf("water.%s.%s", node.Phase, node.TargetVersion),
+			Time:      node.Duration.Seconds(),
+			SystemOut: fmt.Sprintf("%s -> %s, %d attempt(s)", node.FromVersion, node.ToVersion, node.Attempts),
+		}
+		if node.State != NodeCompleted {
+			testCase.Failure = &junitMessage{Message: node.Error, Type: string(node.State), Text: node.Error}
+		}
+		suites[i].add(testCase)
+	}
+
+	if len(r.SkippedNodes) > 0 {
+		skippedSuite := junitTestSuite{Name: "skipped nodes"}
+		for _, skipped := range r.SkippedNodes {
+			skippedSuite.add(junitTestCase{
+				Name:      skipped.Name,
+				ClassName: "water.skipped",
+				Skipped:   &junitMessage{Message: skipped.Reason},
+			})
+		}
+		suites = append(suites, skippedSuite)
+	}
+
+	runSuite := junitTestSuite{Name: "upgrade", Timestamp: r.StartedAt.Format(time.RFC3339)}
+	runCase := junitTestCase{
+		Name:      fmt.Sprintf("Talos %s, Kubernetes %s", r.Talos.Target, r.Kubernetes.Target),
+		ClassName: "water.upgrade",
+		Time:      r.Duration.Seconds(),
+	}
+	if !r.Succeeded {
+		runCase.Failure = &junitMessage{
+			Message: fmt.Sprintf("upgrade completed with %d error(s)", len(r.Errors)),
+			Type:    "error",
+			Text:    strings.Join(r.Errors, "\n"),
+		}
+		if r.Interrupted {
+			runCase.Failure.Type = "interrupted"
+		}
+	}
+	runSuite.add(runCase)
+	suites = append(suites, runSuite)
+
+	root := junitTestSuites{Name: "water", Time: r.Duration.Seconds(), Suites: suites}
+	for _, suite := range suites {
+		root.Tests += suite.Tests
+		root.Failures += suite.Failures
+		root.Skipped += suite.Skipped
+	}
+
+	data, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report as JUnit XML: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// writeMarkdown renders the report for posting to a pull request or ticket
+func (r Report) writeMarkdown(w io.Writer) error {
+	var b strings.Builder
+
+	b.WriteString("## water upgrade report\n\n")
+	switch {
+	case r.Succeeded:
+		b.WriteString("**Result:** succeeded\n\n")
+	case r.Interrupted:
+		fmt.Fprintf(&b, "**Result:** interrupted before all nodes were upgraded, with %d error(s)\n\n", len(r.Errors))
+	default:
+		fmt.Fprintf(&b, "**Result:** failed with %d error(s)\n\n", len(r.Errors))
+	}
+
+	b.WriteString("| | Before | Target | Upgraded |\n")
+	b.WriteString("|---|---|---|---|\n")
+	fmt.Fprintf(&b, "| Talos | %s | %s | %s |\n", markdownCell(r.Talos.Current), markdownCell(r.Talos.Target), yesNo(r.TalosUpgraded))
+	fmt.Fprintf(&b, "| Kubernetes | %s | %s | %s |\n\n", markdownCell(r.Kubernetes.Current), markdownCell(r.Kubernetes.Target), yesNo(r.KubernetesUpgraded))
+
+	fmt.Fprintf(&b, "Started %s, took %s.\n", r.StartedAt.Format(time.RFC3339), r.Duration.Round(time.Second))
+
+	if len(r.Nodes) > 0 {
+		b.WriteString("\n### Nodes\n\n")
+		b.WriteString("| Node | Phase | From | To | State | Duration | Attempts | Error |\n")
+		b.WriteString("|---|---|---|---|---|---|---|---|\n")
+		for _, node := range r.Nodes {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s | %d | %s |\n",
+				markdownCell(node.Node),
+				node.Phase,
+				markdownCell(node.FromVersion),
+				markdownCell(node.ToVersion),
+				node.State,
+				node.Duration.Round(time.Second),
+				node.Attempts,
+				markdownCell(node.Error))
+		}
+	}
+
+	if len(r.SkippedNodes) > 0 {
+		b.WriteString("\n### Skipped nodes\n\n")
+		for _, skipped := range r.SkippedNodes {
+			fmt.Fprintf(&b, "- %s: %s\n", skipped.Name, skipped.Reason)
+		}
+	}
+
+	if len(r.Errors) > 0 {
+		b.WriteString("\n### Errors\n\n")
+		for _, err := range r.Errors {
+			fmt.Fprintf(&b, "- %s\n", markdownCell(err))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownCell makes text safe to put into a Markdown table cell
+func markdownCell(text string) string {
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", " ")
+}
+
+// yesNo renders a flag for humans
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
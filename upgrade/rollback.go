@@ -0,0 +1,142 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bouquet2/water/talos"
+	"github.com/rs/zerolog/log"
+)
+
+// RollbackRecord is the outcome of rolling a node back after a failed Talos upgrade
+type RollbackRecord struct {
+	Node          string
+	FailedVersion string
+	TargetVersion string
+	Succeeded     bool
+	Error         string
+	Duration      time.Duration
+}
+
+// AddRollback records the outcome of a node rollback
+func (r *UpgradeResult) AddRollback(record RollbackRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Rollbacks = append(r.Rollbacks, record)
+}
+
+// rollbackNode reverts a node that failed its Talos upgrade to failedVersion back to the version it ran before,
+// waits for it to come back on that version and records the outcome in result
+func (m *Manager) rollbackNode(ctx context.Context, nodeInfo talos.NodeInfo, failedVersion string, result *UpgradeResult) error {
+	log.Warn().
+		Str("node", nodeInfo.Name).
+		Str("failed_version", failedVersion).
+		Str("target_version", nodeInfo.TalosVersion).
+		Msg("Rolling back node to its previous Talos version")
+
+	startTime := time.Now()
+	err := m.performRollback(ctx, nodeInfo)
+
+	record := RollbackRecord{
+		Node:          nodeInfo.Name,
+		FailedVersion: failedVersion,
+		TargetVersion: nodeInfo.TalosVersion,
+		Succeeded:     err == nil,
+		Duration:      time.Since(startTime),
+	}
+
+	if err != nil {
+		record.Error = err.Error()
+		log.Error().
+			Str("node", nodeInfo.Name).
+			Err(err).
+			Msg("Rollback failed, node needs manual intervention")
+		m.recordNode(PhaseTalos, failedVersion, nodeInfo.Name, failedState(ctx), fmt.Errorf("rollback failed: %w", err))
+	} else {
+		log.Info().
+			Str("node", nodeInfo.Name).
+			Str("target_version", nodeInfo.TalosVersion).
+			Dur("duration", record.Duration).
+			Msg("Node rolled back successfully")
+		m.recordNode(PhaseTalos, failedVersion, nodeInfo.Name, NodeRolledBack, nil)
+	}
+
+	if result != nil {
+		result.AddRollback(record)
+	}
+
+	return err
+}
+
+// performRollback calls the Talos rollback API and verifies the node returns on its previous version.
+// A node still running its previous version is left alone: the rollback API swaps the boot entry to the
+// other slot, which would install the failed target version.
+func (m *Manager) performRollback(ctx context.Context, nodeInfo talos.NodeInfo) error {
+	versionCtx, versionCancel := context.WithTimeout(ctx, 30*time.Second)
+	currentVersion, err := m.talosClient.GetNodeTalosVersion(versionCtx, nodeInfo.Endpoint)
+	versionCancel()
+	if err != nil {
+		log.Debug().Str("node", nodeInfo.Name).Err(err).Msg("Failed to get node version before rollback")
+	}
+
+	if err != nil || currentVersion != nodeInfo.TalosVersion {
+		if err := m.rollbackToPreviousSlot(ctx, nodeInfo); err != nil {
+			return err
+		}
+	} else {
+		log.Info().
+			Str("node", nodeInfo.Name).
+			Str("current_version", currentVersion).
+			Msg("Node still runs its previous Talos version, not calling the rollback API")
+	}
+
+	if err := waitForNodesHealthy(ctx, []string{nodeInfo.Name}, "", m.config.Waits.Node); err != nil {
+		return fmt.Errorf("node did not become healthy after rollback: %w", err)
+	}
+
+	// Workloads were drained before the upgrade, let them back now the node is healthy
+	if m.config.Drain.Enabled {
+		m.uncordonNode(ctx, nodeInfo.Name)
+	}
+
+	return nil
+}
+
+// rollbackToPreviousSlot calls the Talos rollback API and waits for the node to come back on its previous version
+func (m *Manager) rollbackToPreviousSlot(ctx context.Context, nodeInfo talos.NodeInfo) error {
+	// A failed node may not answer at all, in which case any answer after the rollback will do
+	bootCtx, bootCancel := context.WithTimeout(ctx, 30*time.Second)
+	bootTime, err := m.talosClient.GetNodeBootTime(bootCtx, nodeInfo.Endpoint)
+	bootCancel()
+	if err != nil {
+		log.Debug().Str("node", nodeInfo.Name).Err(err).Msg("Failed to get node boot time before rollback")
+		bootTime = 0
+	}
+
+	rollbackCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	err = m.talosClient.RollbackNode(rollbackCtx, nodeInfo.Endpoint)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	err = m.talosClient.WaitForNodeReboot(ctx, nodeInfo.Endpoint, bootTime, m.config.Waits.RebootTimeout)
+	if err != nil {
+		return fmt.Errorf("node did not come back after rollback: %w", err)
+	}
+
+	versionCtx, versionCancel := context.WithTimeout(ctx, 30*time.Second)
+	currentVersion, err := m.talosClient.GetNodeTalosVersion(versionCtx, nodeInfo.Endpoint)
+	versionCancel()
+	if err != nil {
+		return fmt.Errorf("failed to verify version after rollback: %w", err)
+	}
+
+	if currentVersion != nodeInfo.TalosVersion {
+		return fmt.Errorf("node reports version %s after rollback, expected %s", currentVersion, nodeInfo.TalosVersion)
+	}
+
+	return nil
+}
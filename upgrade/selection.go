@@ -0,0 +1,130 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/talos"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// SkipAnnotation is the node annotation that holds a node back from upgrades when set to "true"
+const SkipAnnotation = "water.bouquet2/skip"
+
+// SkippedNode is a node held back from the upgrade by node selection
+type SkippedNode struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// selectNodes splits cluster nodes into those eligible for upgrade and those held back by
+// the nodes.include/nodes.exclude configuration or the skip annotation
+func (m *Manager) selectNodes(ctx context.Context, nodes []talos.NodeInfo) ([]talos.NodeInfo, []SkippedNode, error) {
+	// Labels and annotations only live in Kubernetes, so fetch them once for all nodes
+	kubeClusterInfo, err := k8s.GetClusterInfo(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get node labels and annotations: %w", err)
+	}
+
+	kubeNodes := make(map[string]k8s.NodeInfo)
+	for _, node := range kubeClusterInfo.Nodes {
+		kubeNodes[node.Name] = node
+	}
+
+	var selected []talos.NodeInfo
+	var skipped []SkippedNode
+
+	for _, node := range nodes {
+		reason, err := m.skipReason(node.Name, kubeNodes[node.Name])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if reason != "" {
+			log.Info().
+				Str("node", node.Name).
+				Str("reason", reason).
+				Msg("Node excluded from upgrade")
+			skipped = append(skipped, SkippedNode{Name: node.Name, Reason: reason})
+			continue
+		}
+
+		selected = append(selected, node)
+	}
+
+	return selected, skipped, nil
+}
+
+// skipReason returns why a node is held back from the upgrade, or an empty string if it is selected
+func (m *Manager) skipReason(nodeName string, kubeNode k8s.NodeInfo) (string, error) {
+	if strings.EqualFold(kubeNode.Annotations[SkipAnnotation], "true") {
+		return fmt.Sprintf("annotated with %s=true", SkipAnnotation), nil
+	}
+
+	include := m.config.Nodes.Include
+	if !include.IsEmpty() {
+		matched, err := matchesSelector(include, nodeName, kubeNode.Labels)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate nodes.include: %w", err)
+		}
+		if !matched {
+			return "not matched by nodes.include", nil
+		}
+	}
+
+	exclude := m.config.Nodes.Exclude
+	if !exclude.IsEmpty() {
+		matched, err := matchesSelector(exclude, nodeName, kubeNode.Labels)
+		if err != nil {
+			return "", fmt.Errorf("failed to evaluate nodes.exclude: %w", err)
+		}
+		if matched {
+			return "matched by nodes.exclude", nil
+		}
+	}
+
+	return "", nil
+}
+
+// matchesSelector reports whether a node matches every criterion set on the selector:
+// the label selector, and at least one of the name patterns
+func matchesSelector(selector config.NodeSelector, nodeName string, nodeLabels map[string]string) (bool, error) {
+	if selector.Labels != "" {
+		labelSelector, err := labels.Parse(selector.Labels)
+		if err != nil {
+			return false, fmt.Errorf("invalid label selector '%s': %w", selector.Labels, err)
+		}
+		if !labelSelector.Matches(labels.Set(nodeLabels)) {
+			return false, nil
+		}
+	}
+
+	if len(selector.Names) > 0 {
+		for _, pattern := range selector.Names {
+			matched, err := path.Match(pattern, nodeName)
+			if err != nil {
+				return false, fmt.Errorf("invalid name pattern '%s': %w", pattern, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// skippedNodeNames returns the names of skipped nodes
+func skippedNodeNames(skipped []SkippedNode) []string {
+	names := make([]string, 0, len(skipped))
+	for _, node := range skipped {
+		names = append(names, node.Name)
+	}
+	return names
+}
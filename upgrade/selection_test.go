@@ -0,0 +1,78 @@
+package upgrade
+
+import (
+	"testing"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/k8s"
+)
+
+func TestMatchesSelector(t *testing.T) {
+	gpuLabels := map[string]string{"gpu": "true", "zone": "a"}
+
+	tests := []struct {
+		name     string
+		selector config.NodeSelector
+		node     string
+		labels   map[string]string
+		want     bool
+		wantErr  bool
+	}{
+		{"empty selector", config.NodeSelector{}, "worker-1", nil, true, false},
+		{"labels match", config.NodeSelector{Labels: "gpu=true"}, "worker-1", gpuLabels, true, false},
+		{"set based labels match", config.NodeSelector{Labels: "gpu=true,zone in (a,b)"}, "worker-1", gpuLabels, true, false},
+		{"labels do not match", config.NodeSelector{Labels: "zone=b"}, "worker-1", gpuLabels, false, false},
+		{"labels on a node without labels", config.NodeSelector{Labels: "gpu=true"}, "worker-1", nil, false, false},
+		{"name matches one pattern", config.NodeSelector{Names: []string{"cp-*", "worker-?"}}, "worker-1", nil, true, false},
+		{"name matches no pattern", config.NodeSelector{Names: []string{"cp-*"}}, "worker-1", nil, false, false},
+		{"labels and name match", config.NodeSelector{Labels: "gpu=true", Names: []string{"worker-*"}}, "worker-1", gpuLabels, true, false},
+		{"labels match but name does not", config.NodeSelector{Labels: "gpu=true", Names: []string{"cp-*"}}, "worker-1", gpuLabels, false, false},
+		{"name matches but labels do not", config.NodeSelector{Labels: "gpu=false", Names: []string{"worker-*"}}, "worker-1", gpuLabels, false, false},
+		{"invalid label selector", config.NodeSelector{Labels: "gpu in"}, "worker-1", gpuLabels, false, true},
+		{"invalid name pattern", config.NodeSelector{Names: []string{"worker-["}}, "worker-1", nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchesSelector(tt.selector, tt.node, tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("matchesSelector() error = %v, want error: %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("matchesSelector() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	m := &Manager{config: &config.Config{Nodes: config.NodesConfig{
+		Include: config.NodeSelector{Names: []string{"worker-*"}},
+		Exclude: config.NodeSelector{Labels: "gpu=true"},
+	}}}
+
+	tests := []struct {
+		name     string
+		node     string
+		kubeNode k8s.NodeInfo
+		want     string
+	}{
+		{"selected", "worker-1", k8s.NodeInfo{}, ""},
+		{"not included", "cp-1", k8s.NodeInfo{}, "not matched by nodes.include"},
+		{"excluded", "worker-2", k8s.NodeInfo{Labels: map[string]string{"gpu": "true"}}, "matched by nodes.exclude"},
+		{"skip annotation", "worker-3", k8s.NodeInfo{Annotations: map[string]string{SkipAnnotation: "True"}}, "annotated with water.bouquet2/skip=true"},
+		{"skip annotation not true", "worker-4", k8s.NodeInfo{Annotations: map[string]string{SkipAnnotation: "no"}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := m.skipReason(tt.node, tt.kubeNode)
+			if err != nil {
+				t.Fatalf("skipReason() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("skipReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+// errStopRollout marks failures after which no further nodes may be upgraded, e.g. an unhealthy etcd,
+// a closing maintenance window or a stopped run
+var errStopRollout = errors.New("rollout stopped")
+
+// errStopped marks a run that was asked to stop before all of its nodes were upgraded
+var errStopped = errors.New("upgrade stopped")
+
+// Stop asks a running upgrade to stop cleanly: the nodes being upgraded are finished, no further node
+// is started and the journal stays open for --resume. Cancelling the context of the run aborts it instead.
+// Stop may be called more than once and from any goroutine.
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		log.Warn().Msg("Upgrade asked to stop, finishing the nodes in progress")
+		close(m.stop)
+	})
+}
+
+// checkInterrupted refuses to start further nodes once Stop was called, ctx was cancelled
+// or the upgrade lock was lost
+func (m *Manager) checkInterrupted(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: upgrade aborted: %w", errStopRollout, err)
+	}
+
+	if err := m.checkLock(); err != nil {
+		return fmt.Errorf("%w: %w", errStopRollout, err)
+	}
+
+	select {
+	case <-m.stop:
+		return fmt.Errorf("%w: %w", errStopRollout, errStopped)
+	default:
+		return nil
+	}
+}
+
+// interrupted reports whether err ended the run because it was stopped, aborted or lost its lock
+// rather than because something failed
+func interrupted(ctx context.Context, err error) bool {
+	return errors.Is(err, errStopped) || errors.Is(err, errLockLost) || ctx.Err() != nil
+}
+
+// failedState is the state a node is recorded in when its work failed: aborted if the run was aborted,
+// so that a resumed run picks the node up where it was, failed otherwise
+func failedState(ctx context.Context) NodeState {
+	if ctx.Err() != nil {
+		return NodeAborted
+	}
+	return NodeFailed
+}
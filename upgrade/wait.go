@@ -0,0 +1,37 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/k8s"
+	"github.com/rs/zerolog/log"
+)
+
+// waitForNodesHealthy waits for the nodes to be Ready, on the expected kubelet version and running their
+// static pods, then for whatever is left of the minimum soak time. An empty kubeletVersion skips the version check.
+// Cancelling ctx ends the wait, including the soak, with an error.
+func waitForNodesHealthy(ctx context.Context, nodeNames []string, kubeletVersion string, wait config.WaitConfig) error {
+	startTime := time.Now()
+
+	if err := k8s.WaitForNodesHealthy(ctx, nodeNames, kubeletVersion, wait.Timeout); err != nil {
+		return err
+	}
+
+	if remaining := wait.MinSoak - time.Since(startTime); remaining > 0 {
+		log.Info().
+			Strs("nodes", nodeNames).
+			Dur("remaining", remaining).
+			Msg("Nodes are healthy, waiting out the minimum soak time...")
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("soak time cut short: %w", ctx.Err())
+		case <-time.After(remaining):
+		}
+	}
+
+	return nil
+}
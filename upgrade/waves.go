@@ -0,0 +1,209 @@
+package upgrade
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bouquet2/water/config"
+	"github.com/bouquet2/water/k8s"
+	"github.com/bouquet2/water/talos"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// wave is an ordered group of nodes upgraded together
+type wave struct {
+	name              string
+	controlPlaneNodes []string
+	workerNodes       []string
+	// workerConcurrency bounds how many worker nodes of the wave are upgraded at once
+	workerConcurrency int
+	// soak is the minimum time to wait after the wave before the next one starts
+	soak time.Duration
+}
+
+// size returns the number of nodes in the wave
+func (w wave) size() int {
+	return len(w.controlPlaneNodes) + len(w.workerNodes)
+}
+
+// planWaves groups nodes into the ordered waves they are upgraded in. With waves configured,
+// each node joins the first wave that selects it and unmatched nodes form a final "remaining" wave.
+// Without configured waves, nodes are split into a control plane and a worker wave following order,
+// soaking for waits.phase.minSoak between them.
+func (m *Manager) planWaves(ctx context.Context, nodes []talos.NodeInfo, order config.UpgradeOrder, workerConcurrency int) ([]wave, error) {
+	if len(m.config.Waves) == 0 {
+		controlPlane := wave{name: "control-plane", workerConcurrency: 1}
+		workers := wave{name: "workers", workerConcurrency: workerConcurrency}
+		for _, node := range nodes {
+			if node.IsControlPlane {
+				controlPlane.controlPlaneNodes = append(controlPlane.controlPlaneNodes, node.Name)
+			} else {
+				workers.workerNodes = append(workers.workerNodes, node.Name)
+			}
+		}
+
+		if order == config.WorkersFirst {
+			workers.soak = m.config.Waits.Phase.MinSoak
+			return []wave{workers, controlPlane}, nil
+		}
+		controlPlane.soak = m.config.Waits.Phase.MinSoak
+		return []wave{controlPlane, workers}, nil
+	}
+
+	nodeLabels, err := m.nodeLabels(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	waves := make([]wave, 0, len(m.config.Waves)+1)
+	for _, waveConfig := range m.config.Waves {
+		waves = append(waves, wave{
+			name:              waveConfig.Name,
+			workerConcurrency: max(waveConfig.Concurrency, 1),
+			soak:              waveConfig.Soak,
+		})
+	}
+	remaining := wave{name: "remaining", workerConcurrency: workerConcurrency}
+
+	for _, node := range nodes {
+		target := &remaining
+		for i, waveConfig := range m.config.Waves {
+			matched, err := waveSelects(waveConfig, node.Name, nodeLabels[node.Name])
+			if err != nil {
+				return nil, fmt.Errorf("failed to evaluate wave %s: %w", waveConfig.Name, err)
+			}
+			if matched {
+				target = &waves[i]
+				break
+			}
+		}
+
+		if node.IsControlPlane {
+			target.controlPlaneNodes = append(target.controlPlaneNodes, node.Name)
+		} else {
+			target.workerNodes = append(target.workerNodes, node.Name)
+		}
+	}
+
+	if remaining.size() > 0 {
+		log.Info().
+			Strs("control_plane_nodes", remaining.controlPlaneNodes).
+			Strs("worker_nodes", remaining.workerNodes).
+			Msg("Some nodes are not selected by any wave, they will be upgraded in a final 'remaining' wave")
+		waves = append(waves, remaining)
+	}
+
+	return waves, nil
+}
+
+// waveSelects reports whether a wave selects a node, either by name or by label selector
+func waveSelects(waveConfig config.WaveConfig, nodeName string, nodeLabels map[string]string) (bool, error) {
+	if contains(waveConfig.Nodes, nodeName) {
+		return true, nil
+	}
+
+	if waveConfig.Selector == "" {
+		return false, nil
+	}
+
+	selector, err := labels.Parse(waveConfig.Selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid selector '%s': %w", waveConfig.Selector, err)
+	}
+
+	return selector.Matches(labels.Set(nodeLabels)), nil
+}
+
+// nodeLabels returns the Kubernetes labels of every node, keyed by node name
+func (m *Manager) nodeLabels(ctx context.Context) (map[string]map[string]string, error) {
+	kubeClusterInfo, err := k8s.GetClusterInfo(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node labels: %w", err)
+	}
+
+	nodeLabels := make(map[string]map[string]string)
+	for _, node := range kubeClusterInfo.Nodes {
+		nodeLabels[node.Name] = node.Labels
+	}
+
+	return nodeLabels, nil
+}
+
+// runWaves upgrades the waves in order using upgradeFn, which receives the nodes and their concurrency.
+// Control plane nodes of a wave always go one at a time before its worker nodes. Before the next wave
+// starts, every node of the wave must be healthy and on kubeletVersion, if one is given.
+func (m *Manager) runWaves(ctx context.Context, waves []wave, upgradeType, kubeletVersion string, upgradeFn func(nodeNames []string, concurrency int) error) error {
+	for i, w := range waves {
+		if w.size() == 0 {
+			log.Debug().Str("wave", w.name).Msg("Wave has no nodes to upgrade, skipping")
+			continue
+		}
+
+		log.Info().
+			Str("wave", w.name).
+			Int("wave_index", i+1).
+			Int("wave_count", len(waves)).
+			Str("upgrade_type", upgradeType).
+			Strs("control_plane_nodes", w.controlPlaneNodes).
+			Strs("worker_nodes", w.workerNodes).
+			Int("worker_concurrency", w.workerConcurrency).
+			Msg("Starting upgrade wave")
+
+		if len(w.controlPlaneNodes) > 0 {
+			if err := upgradeFn(w.controlPlaneNodes, 1); err != nil {
+				log.Error().
+					Err(err).
+					Str("wave", w.name).
+					Strs("nodes", w.controlPlaneNodes).
+					Msg("Control plane upgrade failed")
+				return fmt.Errorf("control plane upgrade in wave %s failed: %w", w.name, err)
+			}
+		}
+
+		if len(w.workerNodes) > 0 {
+			if err := upgradeFn(w.workerNodes, w.workerConcurrency); err != nil {
+				log.Error().
+					Err(err).
+					Str("wave", w.name).
+					Strs("nodes", w.workerNodes).
+					Msg("Worker node upgrade failed")
+				return fmt.Errorf("worker node upgrade in wave %s failed: %w", w.name, err)
+			}
+		}
+
+		log.Info().Str("wave", w.name).Msg("Upgrade wave completed")
+
+		// Let the wave settle and soak before the next one starts, unless the run was stopped meanwhile
+		if hasPendingWaves(waves[i+1:]) {
+			if err := m.checkInterrupted(ctx); err != nil {
+				return err
+			}
+
+			log.Info().
+				Str("wave", w.name).
+				Dur("min_soak", w.soak).
+				Dur("timeout", m.config.Waits.Phase.Timeout).
+				Msg("Waiting for wave to become healthy before starting the next one...")
+
+			waveNodes := append(append([]string{}, w.controlPlaneNodes...), w.workerNodes...)
+			wait := config.WaitConfig{MinSoak: w.soak, Timeout: m.config.Waits.Phase.Timeout}
+			if err := waitForNodesHealthy(ctx, waveNodes, kubeletVersion, wait); err != nil {
+				return fmt.Errorf("wave %s did not become healthy: %w", w.name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hasPendingWaves reports whether any of the waves still has nodes to upgrade
+func hasPendingWaves(waves []wave) bool {
+	for _, w := range waves {
+		if w.size() > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -111,8 +111,8 @@ func parseVersion(version string) ([3]int, error) {
 // NeedsUpgrade determines if an upgrade is needed from current to target version
 func NeedsUpgrade(currentVersion, targetVersion string) (bool, error) {
 	log.Info().
-		Str("current", currentVersion).
-		Str("target", targetVersion).
+		Str("current_version", currentVersion).
+		Str("target_version", targetVersion).
 		Msg("Checking if upgrade is needed")
 
 	result, err := Compare(currentVersion, targetVersion)
@@ -123,8 +123,8 @@ func NeedsUpgrade(currentVersion, targetVersion string) (bool, error) {
 	needsUpgrade := result == Older
 	
 	log.Info().
-		Str("current", currentVersion).
-		Str("target", targetVersion).
+		Str("current_version", currentVersion).
+		Str("target_version", targetVersion).
 		Bool("needs_upgrade", needsUpgrade).
 		Str("comparison", result.String()).
 		Msg("Upgrade check completed")
@@ -0,0 +1,155 @@
+package version
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// KubernetesRange is the span of Kubernetes minor versions a Talos minor release supports, e.g. "v1.28" to "v1.33"
+type KubernetesRange struct {
+	Min string
+	Max string
+}
+
+// CompatibilityMatrix maps Talos minor releases, e.g. "v1.10", to the Kubernetes versions they support
+type CompatibilityMatrix map[string]KubernetesRange
+
+// CompatibilityEntry is a single row of a compatibility override file
+type CompatibilityEntry struct {
+	Talos         string `mapstructure:"talos"`
+	MinKubernetes string `mapstructure:"minKubernetes"`
+	MaxKubernetes string `mapstructure:"maxKubernetes"`
+}
+
+// defaultCompatibility follows the Talos support matrix
+var defaultCompatibility = CompatibilityMatrix{
+	"v1.5":  {Min: "v1.23", Max: "v1.28"},
+	"v1.6":  {Min: "v1.24", Max: "v1.29"},
+	"v1.7":  {Min: "v1.25", Max: "v1.30"},
+	"v1.8":  {Min: "v1.26", Max: "v1.31"},
+	"v1.9":  {Min: "v1.27", Max: "v1.32"},
+	"v1.10": {Min: "v1.28", Max: "v1.33"},
+	"v1.11": {Min: "v1.29", Max: "v1.34"},
+	"v1.12": {Min: "v1.30", Max: "v1.35"},
+}
+
+// LoadCompatibilityMatrix returns the built-in compatibility matrix, with the entries of overrideFile
+// added or replacing built-in ones. An empty overrideFile returns the built-in matrix.
+//
+// The override file lists entries under a "compatibility" key:
+//
+//	compatibility:
+//	  - talos: v1.13
+//	    minKubernetes: v1.31
+//	    maxKubernetes: v1.36
+func LoadCompatibilityMatrix(overrideFile string) (CompatibilityMatrix, error) {
+	matrix := make(CompatibilityMatrix, len(defaultCompatibility))
+	for talosMinor, kubernetesRange := range defaultCompatibility {
+		matrix[talosMinor] = kubernetesRange
+	}
+
+	if overrideFile == "" {
+		return matrix, nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(overrideFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read compatibility override file: %w", err)
+	}
+
+	var entries []CompatibilityEntry
+	if err := v.UnmarshalKey("compatibility", &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse compatibility override file: %w", err)
+	}
+
+	for i, entry := range entries {
+		talosMinor, err := normalizeMinor(entry.Talos)
+		if err != nil {
+			return nil, fmt.Errorf("compatibility entry %d: invalid talos version: %w", i, err)
+		}
+		if _, err := normalizeMinor(entry.MinKubernetes); err != nil {
+			return nil, fmt.Errorf("compatibility entry %d: invalid minKubernetes: %w", i, err)
+		}
+		if _, err := normalizeMinor(entry.MaxKubernetes); err != nil {
+			return nil, fmt.Errorf("compatibility entry %d: invalid maxKubernetes: %w", i, err)
+		}
+
+		matrix[talosMinor] = KubernetesRange{Min: entry.MinKubernetes, Max: entry.MaxKubernetes}
+	}
+
+	log.Info().
+		Str("file", overrideFile).
+		Int("entries", len(entries)).
+		Msg("Loaded compatibility overrides")
+
+	return matrix, nil
+}
+
+// Check returns an error if the given Talos version does not support the given Kubernetes version,
+// or if the Talos release is missing from the matrix
+func (c CompatibilityMatrix) Check(talosVersion, kubernetesVersion string) error {
+	talosMinor, err := normalizeMinor(talosVersion)
+	if err != nil {
+		return fmt.Errorf("invalid Talos version '%s': %w", talosVersion, err)
+	}
+
+	kubernetesRange, exists := c[talosMinor]
+	if !exists {
+		return fmt.Errorf("no compatibility data for Talos %s, add it to a compatibility override file", talosMinor)
+	}
+
+	kubernetesMinor, err := parseMinor(kubernetesVersion)
+	if err != nil {
+		return fmt.Errorf("invalid Kubernetes version '%s': %w", kubernetesVersion, err)
+	}
+	minMinor, err := parseMinor(kubernetesRange.Min)
+	if err != nil {
+		return fmt.Errorf("invalid minimum Kubernetes version for Talos %s: %w", talosMinor, err)
+	}
+	maxMinor, err := parseMinor(kubernetesRange.Max)
+	if err != nil {
+		return fmt.Errorf("invalid maximum Kubernetes version for Talos %s: %w", talosMinor, err)
+	}
+
+	if minorLess(kubernetesMinor, minMinor) || minorLess(maxMinor, kubernetesMinor) {
+		return fmt.Errorf("Talos %s supports Kubernetes %s to %s, not %s",
+			talosVersion, kubernetesRange.Min, kubernetesRange.Max, kubernetesVersion)
+	}
+
+	return nil
+}
+
+// parseMinor parses the major and minor numbers of a version such as "v1.10" or "v1.10.5"
+func parseMinor(version string) ([2]int, error) {
+	v := strings.TrimPrefix(version, "v")
+	// Pre-release suffixes such as "-beta.1" may contain dots of their own
+	v, _, _ = strings.Cut(v, "-")
+	if strings.Count(v, ".") == 1 {
+		v += ".0"
+	}
+
+	parts, err := parseVersion(v)
+	if err != nil {
+		return [2]int{}, err
+	}
+
+	return [2]int{parts[0], parts[1]}, nil
+}
+
+// normalizeMinor returns the "vMAJOR.MINOR" form of a version such as "1.10" or "v1.10.5"
+func normalizeMinor(version string) (string, error) {
+	parts, err := parseMinor(version)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("v%d.%d", parts[0], parts[1]), nil
+}
+
+// minorLess reports whether minor release a comes before b
+func minorLess(a, b [2]int) bool {
+	return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+}
@@ -0,0 +1,136 @@
+package version
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompatibilityMatrixCheck(t *testing.T) {
+	matrix := CompatibilityMatrix{
+		"v1.10": {Min: "v1.28", Max: "v1.33"},
+		"v1.11": {Min: "1.29", Max: "1.34.0"},
+		"v1.12": {Min: "v1.30", Max: "invalid"},
+	}
+
+	tests := []struct {
+		name       string
+		talos      string
+		kubernetes string
+		wantErr    bool
+	}{
+		{"inside range", "v1.10.5", "v1.30.2", false},
+		{"lowest supported minor", "v1.10.0", "v1.28.0", false},
+		{"highest supported minor with any patch", "v1.10.5", "v1.33.9", false},
+		{"below range", "v1.10.5", "v1.27.4", true},
+		{"above range", "v1.10.5", "v1.34.0", true},
+		{"range without v prefix", "v1.11.2", "v1.34.1", false},
+		{"versions without v prefix", "1.11.2", "1.29.0", false},
+		{"Talos pre-release", "v1.11.0-beta.1", "v1.34.0", false},
+		{"Talos minor version only", "v1.10", "v1.33.0", false},
+		{"Talos release missing", "v1.13.0", "v1.34.0", true},
+		{"invalid Talos version", "latest", "v1.30.0", true},
+		{"invalid Kubernetes version", "v1.10.5", "v1", true},
+		{"invalid range", "v1.12.0", "v1.31.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := matrix.Check(tt.talos, tt.kubernetes)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check(%s, %s) error = %v, wantErr %t", tt.talos, tt.kubernetes, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultCompatibility(t *testing.T) {
+	matrix, err := LoadCompatibilityMatrix("")
+	if err != nil {
+		t.Fatalf("LoadCompatibilityMatrix: %v", err)
+	}
+
+	for talosMinor, kubernetesRange := range defaultCompatibility {
+		for _, kubernetesVersion := range []string{kubernetesRange.Min + ".0", kubernetesRange.Max + ".0"} {
+			if err := matrix.Check(talosMinor+".0", kubernetesVersion); err != nil {
+				t.Errorf("Check(%s.0, %s): %v", talosMinor, kubernetesVersion, err)
+			}
+		}
+	}
+}
+
+func TestLoadCompatibilityMatrix(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		talos    string
+		want     KubernetesRange
+		wantErr  bool
+	}{
+		{
+			name:     "new Talos release",
+			override: "compatibility:\n  - talos: v1.13\n    minKubernetes: v1.31\n    maxKubernetes: v1.36\n",
+			talos:    "v1.13",
+			want:     KubernetesRange{Min: "v1.31", Max: "v1.36"},
+		},
+		{
+			name:     "replaced built-in release",
+			override: "compatibility:\n  - talos: 1.10.3\n    minKubernetes: v1.29\n    maxKubernetes: v1.33\n",
+			talos:    "v1.10",
+			want:     KubernetesRange{Min: "v1.29", Max: "v1.33"},
+		},
+		{
+			name:     "built-in release kept",
+			override: "compatibility:\n  - talos: v1.13\n    minKubernetes: v1.31\n    maxKubernetes: v1.36\n",
+			talos:    "v1.12",
+			want:     defaultCompatibility["v1.12"],
+		},
+		{
+			name:     "invalid talos version",
+			override: "compatibility:\n  - talos: next\n    minKubernetes: v1.31\n    maxKubernetes: v1.36\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid minKubernetes",
+			override: "compatibility:\n  - talos: v1.13\n    maxKubernetes: v1.36\n",
+			wantErr:  true,
+		},
+		{
+			name:     "invalid maxKubernetes",
+			override: "compatibility:\n  - talos: v1.13\n    minKubernetes: v1.31\n    maxKubernetes: 1\n",
+			wantErr:  true,
+		},
+		{
+			name:     "unreadable file",
+			override: "compatibility: [",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			overrideFile := filepath.Join(t.TempDir(), "compatibility.yaml")
+			if err := os.WriteFile(overrideFile, []byte(tt.override), 0o600); err != nil {
+				t.Fatalf("failed to write override file: %v", err)
+			}
+
+			matrix, err := LoadCompatibilityMatrix(overrideFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadCompatibilityMatrix error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := matrix[tt.talos]; got != tt.want {
+				t.Errorf("matrix[%s] = %+v, want %+v", tt.talos, got, tt.want)
+			}
+		})
+	}
+
+	if _, exists := defaultCompatibility["v1.13"]; exists {
+		t.Errorf("loading an override changed the built-in matrix")
+	}
+	if _, err := LoadCompatibilityMatrix(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadCompatibilityMatrix of a missing file returned no error")
+	}
+}
@@ -0,0 +1,121 @@
+package version
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UpgradePath returns the versions to upgrade through, one minor release at a time, to get from
+// current to target. Every intermediate minor release is represented by its latest patch from
+// available, and the path always ends with target. An empty path means no upgrade is needed.
+func UpgradePath(current, target string, available []string) ([]string, error) {
+	currentParts, err := parseVersion(strings.TrimPrefix(current, "v"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid current version '%s': %w", current, err)
+	}
+
+	targetParts, err := parseVersion(strings.TrimPrefix(target, "v"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid target version '%s': %w", target, err)
+	}
+
+	comparison, err := Compare(current, target)
+	if err != nil {
+		return nil, err
+	}
+	if comparison != Older {
+		return nil, nil
+	}
+
+	if currentParts[0] != targetParts[0] {
+		return nil, fmt.Errorf("cannot compute an upgrade path across major versions, from %s to %s", current, target)
+	}
+
+	var path []string
+	for minor := currentParts[1] + 1; minor < targetParts[1]; minor++ {
+		hop, err := latestPatch(currentParts[0], minor, available)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, hop)
+	}
+
+	return append(path, target), nil
+}
+
+// SkipsMinorVersions reports whether upgrading from current to target would skip at least one minor release
+func SkipsMinorVersions(current, target string) (bool, error) {
+	currentParts, err := parseVersion(strings.TrimPrefix(current, "v"))
+	if err != nil {
+		return false, fmt.Errorf("invalid current version '%s': %w", current, err)
+	}
+
+	targetParts, err := parseVersion(strings.TrimPrefix(target, "v"))
+	if err != nil {
+		return false, fmt.Errorf("invalid target version '%s': %w", target, err)
+	}
+
+	if currentParts[0] != targetParts[0] {
+		return targetParts[0] > currentParts[0], nil
+	}
+
+	return targetParts[1]-currentParts[1] > 1, nil
+}
+
+// latestPatch returns the newest version of the given minor release in available
+func latestPatch(major, minor int, available []string) (string, error) {
+	var latest string
+	var newestPatch int
+
+	for _, candidate := range available {
+		parts, err := parseVersion(strings.TrimPrefix(candidate, "v"))
+		if err != nil {
+			continue
+		}
+		if parts[0] != major || parts[1] != minor {
+			continue
+		}
+		if latest == "" || parts[2] > newestPatch {
+			latest = candidate
+			newestPatch = parts[2]
+		}
+	}
+
+	if latest == "" {
+		return "", fmt.Errorf("no release found for intermediate version v%d.%d", major, minor)
+	}
+
+	return latest, nil
+}
+
+// ComputeUpgradePath returns the upgrade path from current to target for the given release type.
+// Release data is only fetched when the path has to cross intermediate minor releases.
+func ComputeUpgradePath(ctx context.Context, releaseType ReleaseType, current, target string) ([]string, error) {
+	// Adjacent minor releases need no release data, the path is the target itself
+	path, err := UpgradePath(current, target, nil)
+	if err == nil {
+		return path, nil
+	}
+
+	available, fetchErr := GetAllVersionsWithContext(ctx, releaseType)
+	if fetchErr != nil {
+		return nil, fmt.Errorf("failed to get %s releases for the upgrade path: %w", releaseType, fetchErr)
+	}
+
+	path, err = UpgradePath(current, target, available)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info().
+		Str("type", string(releaseType)).
+		Str("current_version", current).
+		Str("target_version", target).
+		Strs("path", path).
+		Msg("Computed multi-hop upgrade path")
+
+	return path, nil
+}
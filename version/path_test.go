@@ -0,0 +1,105 @@
+package version
+
+import (
+	"slices"
+	"testing"
+)
+
+// releases is a release list in the unordered form GitHub returns it, with a pre-release and a malformed tag
+var releases = []string{
+	"v1.10.6", "v1.9.5", "v1.10.2", "v1.11.0-beta.1", "v1.11.3", "v1.9.0", "v1.11.1", "nightly", "v2.0.0",
+}
+
+func TestUpgradePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		current   string
+		target    string
+		available []string
+		want      []string
+		wantErr   bool
+	}{
+		{"same version", "v1.10.2", "v1.10.2", releases, nil, false},
+		{"downgrade", "v1.11.1", "v1.10.6", releases, nil, false},
+		{"patch release", "v1.10.2", "v1.10.6", nil, []string{"v1.10.6"}, false},
+		{"adjacent minor release", "v1.9.5", "v1.10.6", nil, []string{"v1.10.6"}, false},
+		{"one intermediate minor release", "v1.9.0", "v1.11.3", releases, []string{"v1.10.6", "v1.11.3"}, false},
+		{"two intermediate minor releases", "v1.8.4", "v1.11.3", releases, []string{"v1.9.5", "v1.10.6", "v1.11.3"}, false},
+		{"without v prefix", "1.9.0", "1.11.3", releases, []string{"v1.10.6", "1.11.3"}, false},
+		{"intermediate release missing", "v1.7.0", "v1.10.6", releases, nil, true},
+		{"no release data", "v1.9.0", "v1.11.3", nil, nil, true},
+		{"across major versions", "v1.11.3", "v2.0.0", releases, nil, true},
+		{"invalid current version", "latest", "v1.11.3", releases, nil, true},
+		{"invalid target version", "v1.9.0", "v1.11", releases, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UpgradePath(tt.current, tt.target, tt.available)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UpgradePath(%s, %s) error = %v, wantErr %t", tt.current, tt.target, err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("UpgradePath(%s, %s) = %v, want %v", tt.current, tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatestPatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		minor   int
+		want    string
+		wantErr bool
+	}{
+		{"newest of unordered patches", 10, "v1.10.6", false},
+		{"first patch listed is newest", 9, "v1.9.5", false},
+		{"pre-release older than patch releases", 11, "v1.11.3", false},
+		{"no release of minor", 12, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := latestPatch(1, tt.minor, releases)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("latestPatch(1, %d) error = %v, wantErr %t", tt.minor, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("latestPatch(1, %d) = %q, want %q", tt.minor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipsMinorVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		target  string
+		want    bool
+		wantErr bool
+	}{
+		{"patch release", "v1.32.1", "v1.32.4", false, false},
+		{"adjacent minor release", "v1.32.3", "v1.33.0", false, false},
+		{"one skipped minor release", "v1.32.3", "v1.34.1", true, false},
+		{"several skipped minor releases", "1.30.0", "1.34.1", true, false},
+		{"downgrade", "v1.34.1", "v1.32.3", false, false},
+		{"next major version", "v1.34.1", "v2.0.0", true, false},
+		{"previous major version", "v2.0.0", "v1.34.1", false, false},
+		{"invalid current version", "v1.32", "v1.34.1", false, true},
+		{"invalid target version", "v1.32.3", "latest", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SkipsMinorVersions(tt.current, tt.target)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SkipsMinorVersions(%s, %s) error = %v, wantErr %t", tt.current, tt.target, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("SkipsMinorVersions(%s, %s) = %t, want %t", tt.current, tt.target, got, tt.want)
+			}
+		})
+	}
+}
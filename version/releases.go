@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -57,8 +58,40 @@ func getReleaseConfig(releaseType ReleaseType) ReleaseConfig {
 	}
 }
 
-// fetchVersionsFromGitHub fetches the latest stable versions from GitHub API
-func fetchVersionsFromGitHub(ctx context.Context, releaseType ReleaseType) ([]string, error) {
+var (
+	// fetchErrors counts failed attempts to fetch releases from GitHub, by release type
+	fetchErrors   = make(map[ReleaseType]uint64)
+	fetchErrorsMu sync.Mutex
+)
+
+// ReleaseFetchErrors returns how many attempts to fetch releases from GitHub have failed, by release type
+func ReleaseFetchErrors() map[ReleaseType]uint64 {
+	fetchErrorsMu.Lock()
+	defer fetchErrorsMu.Unlock()
+
+	counts := make(map[ReleaseType]uint64, len(fetchErrors))
+	for releaseType, count := range fetchErrors {
+		counts[releaseType] = count
+	}
+	return counts
+}
+
+// recordFetchError counts a failed attempt to fetch releases from GitHub
+func recordFetchError(releaseType ReleaseType) {
+	fetchErrorsMu.Lock()
+	defer fetchErrorsMu.Unlock()
+	fetchErrors[releaseType]++
+}
+
+// releasesPerPage is the page size requested from the GitHub releases API
+const releasesPerPage = 100
+
+// maxReleasePages bounds how many pages are fetched when listing every release
+const maxReleasePages = 10
+
+// fetchVersionsFromGitHub fetches stable versions from GitHub API, newest first.
+// A limit of zero pages through every release instead of returning only the latest ones.
+func fetchVersionsFromGitHub(ctx context.Context, releaseType ReleaseType, limit int) ([]string, error) {
 	config := getReleaseConfig(releaseType)
 	if config.RepoURL == "" {
 		return nil, fmt.Errorf("unsupported release type: %s", releaseType)
@@ -74,30 +107,18 @@ func fetchVersionsFromGitHub(ctx context.Context, releaseType ReleaseType) ([]st
 		Timeout: 30 * time.Second,
 	}
 
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, "GET", config.RepoURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	// Set User-Agent header to be a good API citizen
-	req.Header.Set("User-Agent", config.UserAgent)
-
-	// Make the request
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch releases: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
-	}
-
-	// Parse JSON response
 	var releases []GitHubRelease
-	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
-		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	for page := 1; page <= maxReleasePages; page++ {
+		pageReleases, err := fetchReleasePage(ctx, client, config, page)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, pageReleases...)
+
+		// The latest releases are all on the first page
+		if limit > 0 || len(pageReleases) < releasesPerPage {
+			break
+		}
 	}
 
 	log.Debug().
@@ -149,9 +170,9 @@ func fetchVersionsFromGitHub(ctx context.Context, releaseType ReleaseType) ([]st
 		return comparison == Newer
 	})
 
-	// Limit to the configured maximum versions
-	if len(stableVersions) > config.MaxVersions {
-		stableVersions = stableVersions[:config.MaxVersions]
+	// Limit to the requested number of versions
+	if limit > 0 && len(stableVersions) > limit {
+		stableVersions = stableVersions[:limit]
 	}
 
 	log.Debug().
@@ -162,6 +183,39 @@ func fetchVersionsFromGitHub(ctx context.Context, releaseType ReleaseType) ([]st
 	return stableVersions, nil
 }
 
+// fetchReleasePage fetches a single page of releases from the GitHub API
+func fetchReleasePage(ctx context.Context, client *http.Client, config ReleaseConfig, page int) ([]GitHubRelease, error) {
+	url := fmt.Sprintf("%s?per_page=%d&page=%d", config.RepoURL, releasesPerPage, page)
+
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set User-Agent header to be a good API citizen
+	req.Header.Set("User-Agent", config.UserAgent)
+
+	// Make the request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch releases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
+	}
+
+	// Parse JSON response
+	var releases []GitHubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return releases, nil
+}
+
 // GetSupportedVersions returns a list of supported versions for the given release type
 func GetSupportedVersions(releaseType ReleaseType) ([]string, error) {
 	return GetSupportedVersionsWithContext(context.Background(), releaseType)
@@ -169,6 +223,16 @@ func GetSupportedVersions(releaseType ReleaseType) ([]string, error) {
 
 // GetSupportedVersionsWithContext returns supported versions with context support
 func GetSupportedVersionsWithContext(ctx context.Context, releaseType ReleaseType) ([]string, error) {
+	return fetchVersionsWithRetry(ctx, releaseType, getReleaseConfig(releaseType).MaxVersions)
+}
+
+// GetAllVersionsWithContext returns every stable version of the given release type, newest first
+func GetAllVersionsWithContext(ctx context.Context, releaseType ReleaseType) ([]string, error) {
+	return fetchVersionsWithRetry(ctx, releaseType, 0)
+}
+
+// fetchVersionsWithRetry fetches up to limit versions, or all of them for a limit of zero, retrying on failure
+func fetchVersionsWithRetry(ctx context.Context, releaseType ReleaseType, limit int) ([]string, error) {
 	const maxRetries = 3
 	const retryDelay = 2 * time.Second
 
@@ -181,9 +245,10 @@ func GetSupportedVersionsWithContext(ctx context.Context, releaseType ReleaseTyp
 			Str("type", string(releaseType)).
 			Msg("Attempting to fetch versions from GitHub API")
 
-		versions, err := fetchVersionsFromGitHub(ctx, releaseType)
+		versions, err := fetchVersionsFromGitHub(ctx, releaseType, limit)
 		if err != nil {
 			lastErr = err
+			recordFetchError(releaseType)
 			log.Warn().
 				Err(err).
 				Int("attempt", attempt).